@@ -0,0 +1,65 @@
+package gocreate
+
+import (
+    "errors"
+)
+
+// ErrUnbatchable is returned by SendMany and Fleet.Broadcast for a sequence containing a
+// command which cannot be part of a contiguous write: a Baud command or a sensor request.
+var ErrUnbatchable = errors.New("Command cannot be sent as part of a batch")
+
+// batchCommand is a sequence of commands which are written to the transport together.
+type batchCommand struct {
+    Commands []Command
+}
+
+func (b *batchCommand) Assemble() []byte {
+    var data []byte
+    for _, cmd := range b.Commands {
+        data = append(data, cmd.Assemble()...)
+    }
+    return data
+}
+
+func (b *batchCommand) Channel() chan []byte {
+    return nil
+}
+
+func (b *batchCommand) Timeout() int {
+    return 0
+}
+
+// newBatch checks that the commands can be written together and returns the batch.
+func newBatch(cmds []Command) (*batchCommand, error) {
+    for _, cmd := range cmds {
+        if cmd == nil {
+            return nil, ErrInvalidCommand
+        }
+        if _, ok := cmd.(*baudCommand); ok {
+            return nil, ErrUnbatchable
+        }
+        if expectsResponse(cmd) {
+            return nil, ErrUnbatchable
+        }
+    }
+    return &batchCommand{Commands: cmds}, nil
+}
+
+// commandsOf returns the individual commands which make up a command.
+func commandsOf(cmd Command) []Command {
+    if b, ok := cmd.(*batchCommand); ok {
+        return b.Commands
+    }
+    return []Command{cmd}
+}
+
+// containsMotion reports whether a command, or any command in a batch, is a motion
+// command.
+func containsMotion(cmd Command) bool {
+    for _, c := range commandsOf(cmd) {
+        if isMotion(c) {
+            return true
+        }
+    }
+    return false
+}
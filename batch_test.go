@@ -0,0 +1,72 @@
+package gocreate
+
+import (
+    "bytes"
+    "context"
+    "github.com/stretchr/testify/assert"
+    "sync"
+    "testing"
+)
+
+func TestSendManyContiguous(t *testing.T) {
+    dev := &chunkTestDevice{testDevice: newTestDevice()}
+    conn := NewConnection(dev, 57600)
+    ctx := context.Background()
+
+    song := []Note{{Tone: 60, Duration: 32}, {Tone: 64, Duration: 32}}
+    batch := []Command{Song(0, song), PlaySong(0)}
+    var wg sync.WaitGroup
+    for i := 0; i < 4; i++ {
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            assert.Nil(t, conn.SendMany(ctx, batch))
+        }()
+        go func() {
+            defer wg.Done()
+            assert.Nil(t, conn.Send(ctx, Leds(true, true, 0, 255)))
+        }()
+    }
+    wg.Wait()
+    stats := conn.Stats()
+    assert.Nil(t, conn.Close())
+
+    songBytes := append(Song(0, song).Assemble(), PlaySong(0).Assemble()...)
+    ledBytes := Leds(true, true, 0, 255).Assemble()
+    assert.Equal(t, len(dev.chunks), 8, "Expected each batch to be written at once")
+    written := dev.Written()
+    assert.Equal(t, bytes.Count(written, songBytes), 4, "Expected batches not to be interleaved")
+    assert.Equal(t, bytes.Count(written, ledBytes), 4)
+    assert.Equal(t, stats.Throughput.Commands, uint64(12))
+    assert.Equal(t, stats.OpcodeCommands[140], uint64(4))
+    assert.Equal(t, stats.OpcodeCommands[141], uint64(4))
+}
+
+func TestSendManyRejected(t *testing.T) {
+    conn, dev := newTestConnection()
+    ctx := context.Background()
+
+    assert.Equal(t, conn.SendMany(ctx, []Command{Start(), Baud(115200)}), ErrUnbatchable)
+    assert.Equal(t, conn.SendMany(ctx, []Command{Start(), Sensors(PacketWall)}), ErrUnbatchable)
+    assert.Equal(t, conn.SendMany(ctx, []Command{Start(), nil}), ErrInvalidCommand)
+    assert.Nil(t, conn.SendMany(ctx, nil))
+    assert.Nil(t, conn.Close())
+    assert.Empty(t, dev.Written(), "Expected nothing to be sent for a rejected batch")
+}
+
+func TestSendManyEmergencyStop(t *testing.T) {
+    conn, dev := newTestConnection()
+    ctx := context.Background()
+
+    assert.Nil(t, conn.EmergencyStop(nil))
+    assert.Equal(t, conn.SendMany(ctx, []Command{Full(), DriveStraight(100)}), ErrEmergencyStop)
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, dev.Written(), DriveDirect(0, 0).Assemble())
+}
+
+func TestBatchCommandName(t *testing.T) {
+    batch, err := newBatch([]Command{Start(), Full(), Leds(false, false, 0, 0)})
+    assert.Nil(t, err)
+    assert.Equal(t, CommandName(batch), "Start, Full, LEDs")
+    assert.Equal(t, batch.Assemble(), []byte{128, 132, 139, 0, 0, 0})
+}
@@ -0,0 +1,162 @@
+package gocreate
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "time"
+)
+
+// baudSwitchDelay is how long the Create needs to switch to a new baud rate.
+const baudSwitchDelay = 100 * time.Millisecond
+
+// probeRates is the order in which the OI baud rates are tried when detecting the
+// Create's baud rate: the Create's default rate, its alternate power-on rate, and then
+// the remaining rates from fastest to slowest.
+var probeRates = []uint{57600, 19200, 115200, 38400, 28800, 14400, 9600, 4800, 2400, 1200, 600, 300}
+
+// CurrentBaud returns the current baud rate of the connection.  It is updated when the
+// baud rate is changed by a Baud command, SetBaud or DetectBaud.
+func (c *Connection) CurrentBaud() uint {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    return c.baud
+}
+
+func (c *Connection) setBaud(rate uint) {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    c.baud = rate
+}
+
+// SetBaud changes the baud rate used by both the Create and the connection's transport.
+// This is equivalent to sending the Baud command: once the Create has had time to
+// switch, communication at the new rate is verified with a sensor request, and if that
+// fails the connection returns to the previous rate and an error is returned.  The OI
+// must already have been started for the verification to succeed.
+func (c *Connection) SetBaud(ctx context.Context, rate uint) error {
+    cmd := Baud(rate)
+    if cmd == nil {
+        return fmt.Errorf("Unsupported baud rate %d", rate)
+    }
+    return c.Send(ctx, cmd)
+}
+
+func (c *Connection) changeBaud(cmd *baudCommand) error {
+    previous := c.baud
+    if err := c.sendCommand(cmd); err != nil {
+        return err
+    }
+    time.Sleep(baudSwitchDelay)
+
+    err := c.switchTransport(cmd.Rate)
+    if err == nil {
+        return nil
+    }
+
+    // The Create most likely did not switch, so go back to the previous rate.
+    if rollbackErr := c.switchTransport(previous); rollbackErr != nil {
+        return fmt.Errorf("Failed to change baud rate to %d (%s) and could not return to %d (%s)", cmd.Rate, err.Error(),
+            previous, rollbackErr.Error())
+    }
+    return fmt.Errorf("Failed to change baud rate to %d, returned to %d: %s", cmd.Rate, previous, err.Error())
+}
+
+// switchTransport changes the transport's baud rate and verifies that the Create is
+// responding at that rate.
+func (c *Connection) switchTransport(rate uint) error {
+    device, _ := c.transport()
+    if setter, ok := device.(BaudSetter); ok {
+        if err := setter.SetBaud(rate); err != nil {
+            return err
+        }
+    }
+    c.setBaud(rate)
+    return c.verify()
+}
+
+// verify checks that the Create is responding by requesting the OI mode.
+func (c *Connection) verify() error {
+    reply, err := c.exchange(Sensors(PacketOIMode))
+    if err != nil {
+        return err
+    }
+    if Mode(reply[0]) > ModeFull {
+        c.updateStats(func(s *Stats) { s.ParseErrors++ })
+        return fmt.Errorf("Invalid OI mode %d in reply", reply[0])
+    }
+    return nil
+}
+
+// DetectBaud finds the baud rate the Create is using by sending the Start command and a
+// sensor request at each of the OI baud rates in turn, beginning with the connection's
+// current rate, until a valid reply comes back.  The connection is left at the detected
+// rate, with the OI in Passive mode.  If the transport does not implement BaudSetter,
+// only the current rate can be checked.
+func (c *Connection) DetectBaud(ctx context.Context) (uint, error) {
+    var detected uint
+    err := c.do(ctx, func() error {
+        var err error
+        detected, err = c.detect(ctx)
+        return err
+    })
+    return detected, err
+}
+
+// detect probes each of the OI baud rates in turn.  It must be run by the sender
+// goroutine.
+func (c *Connection) detect(ctx context.Context) (uint, error) {
+    previous := c.baud
+    rates := []uint{previous}
+    if device, _ := c.transport(); isBaudSetter(device) {
+        for _, r := range probeRates {
+            if r != previous {
+                rates = append(rates, r)
+            }
+        }
+    }
+
+    for _, r := range rates {
+        if err := ctx.Err(); err != nil {
+            c.restoreBaud(previous)
+            return 0, err
+        }
+        if err := c.probe(r); err == nil {
+            return r, nil
+        }
+    }
+
+    c.restoreBaud(previous)
+    return 0, errors.New("No response from Create at any OI baud rate")
+}
+
+func isBaudSetter(device io.ReadWriteCloser) bool {
+    _, ok := device.(BaudSetter)
+    return ok
+}
+
+// probe checks whether the Create is responding at the given baud rate.
+func (c *Connection) probe(rate uint) error {
+    device, _ := c.transport()
+    if setter, ok := device.(BaudSetter); ok && rate != c.baud {
+        if err := setter.SetBaud(rate); err != nil {
+            return err
+        }
+    }
+    c.setBaud(rate)
+
+    if err := c.sendCommand(Start()); err != nil {
+        return err
+    }
+    return c.verify()
+}
+
+// restoreBaud returns the transport to the given rate without verification.
+func (c *Connection) restoreBaud(rate uint) {
+    device, _ := c.transport()
+    if setter, ok := device.(BaudSetter); ok && rate != c.baud {
+        setter.SetBaud(rate)
+    }
+    c.setBaud(rate)
+}
@@ -0,0 +1,114 @@
+package gocreate
+
+import (
+    "context"
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestSetBaud(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    conn := NewConnection(dev, 57600)
+    ctx := context.Background()
+
+    assert.Nil(t, conn.Send(ctx, Start()))
+    assert.Nil(t, conn.SetBaud(ctx, 19200))
+    assert.Equal(t, conn.CurrentBaud(), uint(19200))
+    assert.Nil(t, conn.Send(ctx, Baud(115200)))
+    assert.Equal(t, conn.CurrentBaud(), uint(115200))
+
+    reply, err := conn.Query(ctx, PacketOIMode)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{byte(ModePassive)})
+
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, dev.rates, []uint{19200, 115200}, "Expected the transport to follow the baud rate changes")
+    assert.Equal(t, dev.Written(), []byte{128, 129, 7, 142, 35, 129, 11, 142, 35, 142, 35})
+}
+
+func TestSetBaudRollback(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    dev.stubborn = true
+    conn := NewConnection(dev, 57600)
+    ctx := context.Background()
+
+    assert.Nil(t, conn.Send(ctx, Start()))
+    err := conn.SetBaud(ctx, 19200)
+    assert.NotNil(t, err, "Expected the baud rate change to fail when the Create does not switch")
+    assert.Equal(t, conn.CurrentBaud(), uint(57600), "Expected the connection to return to the previous rate")
+
+    reply, err := conn.Query(ctx, PacketOIMode)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{byte(ModePassive)})
+
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, dev.rates, []uint{19200, 57600})
+}
+
+func TestSetBaudUnresponsive(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    conn := NewConnection(dev, 57600)
+
+    // The robot does not understand anything, so verification fails at both rates.
+    dev.robotRate = 0
+    err := conn.SetBaud(context.Background(), 19200)
+    assert.NotNil(t, err, "Expected the baud rate change to fail without a reply")
+    assert.Equal(t, conn.CurrentBaud(), uint(57600))
+    assert.Nil(t, conn.Close())
+}
+
+func TestSetBaudUnsupported(t *testing.T) {
+    conn, _ := newTestConnection()
+    err := conn.SetBaud(context.Background(), 12345)
+    assert.NotNil(t, err, "Expected an unsupported baud rate to be rejected")
+    assert.Nil(t, conn.Close())
+}
+
+func TestDetectBaud(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    dev.robotRate = 9600
+    conn := NewConnection(dev, 57600)
+
+    rate, err := conn.DetectBaud(context.Background())
+    assert.Nil(t, err)
+    assert.Equal(t, rate, uint(9600))
+    assert.Equal(t, conn.CurrentBaud(), uint(9600))
+
+    reply, err := conn.Query(context.Background(), PacketOIMode)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{byte(ModePassive)}, "Expected detection to start the OI")
+
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, dev.rates, []uint{19200, 115200, 38400, 28800, 14400, 9600})
+}
+
+func TestDetectBaudCurrent(t *testing.T) {
+    dev := newRobotTestDevice(115200)
+    conn := NewConnection(dev, 115200)
+
+    rate, err := conn.DetectBaud(context.Background())
+    assert.Nil(t, err)
+    assert.Equal(t, rate, uint(115200))
+    assert.Nil(t, conn.Close())
+    assert.Empty(t, dev.rates, "Expected the current rate to be tried first")
+}
+
+func TestDetectBaudFailure(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    dev.robotRate = 0
+    conn := NewConnection(dev, 57600)
+
+    _, err := conn.DetectBaud(context.Background())
+    assert.NotNil(t, err, "Expected detection to fail when nothing replies")
+    assert.Equal(t, conn.CurrentBaud(), uint(57600), "Expected the original rate to be restored")
+    assert.Nil(t, conn.Close())
+}
+
+func TestDetectBaudWithoutBaudSetter(t *testing.T) {
+    conn, dev := newTestConnection()
+
+    _, err := conn.DetectBaud(context.Background())
+    assert.NotNil(t, err)
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, dev.Written(), []byte{128, 142, 35}, "Expected only the current rate to be probed")
+}
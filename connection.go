@@ -1,89 +1,465 @@
 package gocreate
 
 import (
-    "fmt"
-    "github.com/awm/goserial"
+    "context"
+    "errors"
     "io"
+    "log/slog"
+    "sync"
     "time"
 )
 
-// Connection represents an active OI serial connection to a Create.
-//
-// Port is the name of the serial device that the OI connection is using.
-//
-// Baud is the  current baud rate of the serial connection.
+// Connection represents an active OI serial connection to a Create.  All of its methods
+// are safe to call from multiple goroutines.
 type Connection struct {
-    Port      string
-    Baud      uint
+    port      string
+    baud      uint
     device    io.ReadWriteCloser
-    sendQueue chan Command
+    sendQueue chan *sendRequest
+    lock      sync.RWMutex
+    closed    bool
+    finished  chan struct{}
+    closeErr  error
+    rxLock    sync.Mutex
+    pending   *pendingResponse
+    stateLock sync.Mutex
+    pacing    Pacing
+    custom    bool
+    writeLock sync.Mutex
+    writeCond *sync.Cond
+    writing   bool
+    urgent    int
+    lastWrite time.Time
+    written   Throughput
+    coalesce  bool
+    motion    *sendRequest
+    stopped   bool
+    lastMove  time.Time
+    watchdog  chan struct{}
+    tracer    Tracer
+    stats     Stats
+    rxTimeout time.Duration
+    songs     *SongManager
+    songsOnce sync.Once
+    link      *reconnector
+    down      bool
+    linkCond  *sync.Cond
+    onLink    LinkHandler
+    oiMode    Mode
+    liveness  liveness
+    heartbeat chan struct{}
+    safeClose bool
+    chain     []interceptorEntry
+    nextID    int
+}
+
+// sendQueueSize is the default number of commands which can be waiting to be written.
+const sendQueueSize = 16
+
+var (
+    // ErrClosed is returned when sending on a connection which has been closed.
+    ErrClosed = errors.New("Connection is closed")
+    // ErrInvalidCommand is returned when sending a nil command, such as one returned by a
+    // command generator given invalid parameters.
+    ErrInvalidCommand = errors.New("Invalid command")
+    // ErrNoResponse is returned when the Create does not reply to a command which
+    // expects a response, such as a sensor request.
+    ErrNoResponse = errors.New("No response from Create")
+)
+
+// responseSizer is implemented by commands which expect a fixed-length response.
+type responseSizer interface {
+    responseLength() int
+}
+
+// expectsResponse reports whether a command waits for a response from the Create.
+func expectsResponse(cmd Command) bool {
+    _, ok := cmd.(responseSizer)
+    return ok && cmd.Channel() != nil
+}
+
+type pendingResponse struct {
+    length int
+    data   []byte
+    done   chan struct{}
+}
+
+// sendRequest is a queued command, or an action which must be run by the sender
+// goroutine because it uses the transport.
+type sendRequest struct {
+    ctx      context.Context
+    cmd      Command
+    action   func() error
+    done     chan error
+    queued   time.Time
+    replaced chan struct{}
+}
+
+// BaudSetter is implemented by transports which are able to change the baud rate of the
+// underlying link, such as serial ports.  When a Connection's transport implements
+// BaudSetter, SetBaud is called once a Baud command has been sent to the Create and the
+// Create has had time to switch.
+type BaudSetter interface {
+    SetBaud(rate uint) error
 }
 
 // Connect open a new connection to a Create on the given serial port with the
 // specified baud rate.  The Create must already be using the specified baud rate
 // for the connection to function properly, though it can be changed later if necessary.
+//
+// If initialBaud is 0, the baud rate is detected by probing each of the OI baud rates
+// (see DetectBaud).
+//
+// Connect is a shorthand for Open with the WithBaud option, which logs any error and
+// returns nil instead of returning the error.
 func Connect(port string, initialBaud uint) *Connection {
-    config := &serial.Config{Name: port, Baud: int(initialBaud)}
-    s, err := serial.OpenPort(config)
+    conn, err := Open(port, WithBaud(initialBaud))
     if err != nil {
-        fmt.Printf("Serial open error: %s\n", err.Error())
+        slog.Error("OI connection error", "port", port, "error", err)
         return nil
     }
+    return conn
+}
 
-    conn := &Connection{Port: port, Baud: initialBaud, device: s, sendQueue: make(chan Command)}
+// NewConnection creates a connection to a Create over an arbitrary transport, such as a
+// pipe, PTY, network socket or in-memory fake.  The baud rate is the rate the Create is
+// currently using.  If the transport implements BaudSetter it will be told about baud
+// rate changes, otherwise Baud commands only change the Create's rate.
+func NewConnection(transport io.ReadWriteCloser, baud uint) *Connection {
+    return newConnection("", transport, defaultConfig(baud))
+}
+
+func newConnection(port string, transport io.ReadWriteCloser, cfg *config) *Connection {
+    conn := &Connection{
+        port:      port,
+        baud:      cfg.baud,
+        device:    transport,
+        sendQueue: make(chan *sendRequest, cfg.queueSize),
+        finished:  make(chan struct{}),
+        rxTimeout: cfg.readTimeout,
+        tracer:    cfg.tracer,
+        onLink:    cfg.onLink,
+        safeClose: cfg.safeClose,
+    }
+    if cfg.pacing != nil {
+        conn.pacing = *cfg.pacing
+        conn.custom = true
+    }
+    if cfg.reconnect != nil && cfg.reopen != nil {
+        conn.link = &reconnector{policy: *cfg.reconnect, reopen: cfg.reopen}
+    }
+    conn.writeCond = sync.NewCond(&conn.writeLock)
+    conn.linkCond = sync.NewCond(&conn.stateLock)
     go conn.sender()
+    go conn.receiver()
     return conn
 }
 
-func (c *Connection) sendData(data []byte) {
-    if c.Baud == 115200 {
-        for _, b := range data {
-            time.Sleep(200 * time.Microsecond)
-            c.device.Write([]byte{b})
+func (c *Connection) transmit(cmd Command) error {
+    if cmd, ok := cmd.(*baudCommand); ok {
+        return c.changeBaud(cmd)
+    }
+
+    _, err := c.exchange(cmd)
+    if err == nil && containsMotion(cmd) {
+        c.stateLock.Lock()
+        c.lastMove = time.Now()
+        c.stateLock.Unlock()
+    }
+    return err
+}
+
+// exchange writes a command and, if it expects a response, waits for the response and
+// delivers it to the command's channel.
+func (c *Connection) exchange(cmd Command) ([]byte, error) {
+    sizer, ok := cmd.(responseSizer)
+    if !ok || cmd.Channel() == nil || cmd.Timeout() <= 0 {
+        return nil, c.sendCommand(cmd)
+    }
+
+    p := &pendingResponse{length: sizer.responseLength(), done: make(chan struct{})}
+    c.rxLock.Lock()
+    c.pending = p
+    c.rxLock.Unlock()
+
+    start := time.Now()
+    err := c.sendCommand(cmd)
+    if err == nil {
+        timeout := time.Duration(cmd.Timeout()) * time.Millisecond
+        if c.rxTimeout > 0 {
+            timeout = c.rxTimeout
         }
-    } else {
-        c.device.Write(data)
+        timeout += c.transferTime(p.length)
+        select {
+        case <-p.done:
+            latency := time.Since(start)
+            c.updateStats(func(s *Stats) { s.SensorLatency.add(latency) })
+            c.replied(cmd, p.data)
+            select {
+            case cmd.Channel() <- p.data:
+            default:
+            }
+            return p.data, nil
+        case <-time.After(timeout):
+            err = ErrNoResponse
+        }
+    }
+
+    c.rxLock.Lock()
+    if c.pending == p {
+        c.pending = nil
     }
+    partial := len(p.data) > 0
+    c.rxLock.Unlock()
+
+    if err == ErrNoResponse {
+        if partial {
+            c.replied(cmd, nil)
+        } else {
+            c.unanswered()
+        }
+        c.updateStats(func(s *Stats) {
+            if partial {
+                s.ParseErrors++
+            } else {
+                s.Timeouts++
+            }
+        })
+    }
+    return nil, err
 }
 
-func (c *Connection) sender() {
-    for cmd := range c.sendQueue {
-        data := cmd.Assemble()
-        switch cmd := cmd.(type) {
-        default:
-            c.sendData(data)
-        case *baudCommand:
-            c.sendData(data)
-            c.device.Close()
-
-            c.Baud = cmd.Rate
-            config := &serial.Config{Name: c.Port, Baud: int(c.Baud)}
-            s, err := serial.OpenPort(config)
-            if err != nil {
-                panic(fmt.Sprintf("Failed to re-open serial port after baud rate change: %s", err.Error()))
+// transferTime estimates how long it takes to transfer the given number of bytes at the
+// current baud rate, using 10 bits per byte.
+func (c *Connection) transferTime(length int) time.Duration {
+    baud := c.CurrentBaud()
+    if baud == 0 {
+        return 0
+    }
+    return time.Duration(length) * 10 * time.Second / time.Duration(baud)
+}
+
+// Port returns the name of the serial device that the connection is using, or an empty
+// string if the connection was created over some other transport.
+func (c *Connection) Port() string {
+    return c.port
+}
+
+func (c *Connection) receiver() {
+    buf := make([]byte, 256)
+    device, _ := c.transport()
+    for {
+        n, err := device.Read(buf)
+        if n > 0 {
+            c.trace(Inbound, buf[:n])
+            c.updateStats(func(s *Stats) { s.BytesReceived += uint64(n) })
+            c.received(buf[:n])
+        }
+        if err != nil {
+            // Keep receiving from the replacement transport if the link is restored.
+            if device = c.awaitLink(device, err); device == nil {
+                return
             }
-            c.device = s
+        }
+    }
+}
+
+// received passes incoming data to the pending response, if any.  Data which arrives
+// when no response is expected, or beyond the end of the expected response, is
+// discarded.
+func (c *Connection) received(data []byte) {
+    c.rxLock.Lock()
+    defer c.rxLock.Unlock()
 
-            time.Sleep(100 * time.Millisecond)
+    p := c.pending
+    if p == nil {
+        c.updateStats(func(s *Stats) { s.Resyncs++ })
+        return
+    }
+    if need := p.length - len(p.data); len(data) > need {
+        data = data[:need]
+        c.updateStats(func(s *Stats) { s.Resyncs++ })
+    }
+    p.data = append(p.data, data...)
+    if len(p.data) == p.length {
+        c.pending = nil
+        close(p.done)
+    }
+}
+
+func (c *Connection) sender() {
+    for req := range c.sendQueue {
+        // A queued motion command may be replaced until it is taken from the queue.
+        c.stateLock.Lock()
+        if c.motion == req {
+            c.motion = nil
+        }
+        ctx, cmd, done, queued := req.ctx, req.cmd, req.done, req.queued
+        c.stateLock.Unlock()
+
+        if err := ctx.Err(); err != nil {
+            done <- err
+            continue
+        }
+        if req.action != nil {
+            done <- req.action()
+            continue
+        }
+
+        cmd, err := c.intercept(cmd)
+        if err != nil || cmd == nil {
+            done <- err
+            continue
+        }
+        if containsMotion(cmd) && c.Stopped() {
+            done <- ErrEmergencyStop
+            continue
+        }
+
+        err = c.transmit(cmd)
+        if err == nil {
+            latency := time.Since(queued)
+            c.updateStats(func(s *Stats) { s.SendLatency.add(latency) })
         }
+        done <- err
+    }
+
+    if device, down := c.transport(); !down {
+        c.closeErr = device.Close()
     }
+    close(c.finished)
 
-    c.device.Close()
+    c.stateLock.Lock()
+    c.linkCond.Broadcast()
+    c.stateLock.Unlock()
 }
 
-// Send transmits a single OI command to the connected Create.
-func (c *Connection) Send(cmd Command) {
-    c.sendQueue <- cmd
+func (c *Connection) enqueue(ctx context.Context, req *sendRequest) error {
+    c.lock.RLock()
+    defer c.lock.RUnlock()
+
+    if c.closed {
+        return ErrClosed
+    }
+    select {
+    case c.sendQueue <- req:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
 }
 
-// SendMany transmits a sequence of OI commands to the connected Create.
-func (c *Connection) SendMany(cmds []Command) {
-    for _, cmd := range cmds {
-        c.Send(cmd)
+// Send transmits a single OI command to the connected Create, and waits until it has
+// been written to the transport.  An error is returned if the command could not be
+// written, the connection is closed, or the context is cancelled or expires first.  A
+// command whose context is done before its turn to be written is discarded, but one
+// which is already being written when the context is cancelled will still be sent.
+func (c *Connection) Send(ctx context.Context, cmd Command) error {
+    if cmd == nil {
+        return ErrInvalidCommand
     }
+
+    if containsMotion(cmd) && c.Stopped() {
+        return ErrEmergencyStop
+    }
+
+    req := &sendRequest{ctx: ctx, cmd: cmd, done: make(chan error, 1), queued: time.Now()}
+    if c.Coalescing() {
+        return c.sendCoalesced(req)
+    }
+    return c.wait(ctx, req)
+}
+
+// do runs an action on the sender goroutine, in order with queued commands.
+func (c *Connection) do(ctx context.Context, action func() error) error {
+    return c.wait(ctx, &sendRequest{ctx: ctx, action: action, done: make(chan error, 1)})
 }
 
-// Close terminates the serial connection.
-func (c *Connection) Close() {
-    close(c.sendQueue)
+func (c *Connection) wait(ctx context.Context, req *sendRequest) error {
+    if err := c.enqueue(ctx, req); err != nil {
+        return err
+    }
+    return c.await(ctx, req.done)
+}
+
+func (c *Connection) await(ctx context.Context, done chan error) error {
+    select {
+    case err := <-done:
+        return err
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// SendMany transmits a sequence of OI commands to the connected Create as a single
+// contiguous write, so that commands sent by other goroutines cannot be interleaved with
+// them.  This matters for sequences such as Song followed by PlaySong.  The sequence is
+// queued and written as one unit, with a single result.  Baud commands and sensor
+// requests cannot be part of a sequence of more than one command, and cause
+// ErrUnbatchable to be returned without sending anything.
+func (c *Connection) SendMany(ctx context.Context, cmds []Command) error {
+    switch len(cmds) {
+    case 0:
+        return nil
+    case 1:
+        return c.Send(ctx, cmds[0])
+    }
+
+    batch, err := newBatch(cmds)
+    if err != nil {
+        return err
+    }
+    return c.Send(ctx, batch)
+}
+
+// Query requests the value of a sensor packet or packet group from the Create, and
+// waits for the reply.
+func (c *Connection) Query(ctx context.Context, packet SensorPacket) ([]byte, error) {
+    cmd := Sensors(packet)
+    if cmd == nil {
+        return nil, ErrInvalidCommand
+    }
+    if err := c.Send(ctx, cmd); err != nil {
+        return nil, err
+    }
+
+    select {
+    case reply := <-cmd.Channel():
+        return reply, nil
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+}
+
+// Songs returns the song manager shared by all users of this connection.
+func (c *Connection) Songs() *SongManager {
+    c.songsOnce.Do(func() {
+        c.songs = NewSongManager(c)
+    })
+    return c.songs
+}
+
+// Close terminates the connection.  Commands which have already been queued are written
+// before the transport is closed, and Close waits for this to happen.  If safe shutdown
+// is enabled (see SetSafeShutdown), the Create is brought to a safe state after the
+// queued commands.  Once Close has been called, further calls to Send fail with
+// ErrClosed.  The error from closing the transport, or otherwise from the safe
+// shutdown, is returned.
+func (c *Connection) Close() error {
+    c.StopWatchdog()
+    c.StopHeartbeat()
+    shutdownErr := c.safeShutdown()
+
+    c.lock.Lock()
+    if !c.closed {
+        c.closed = true
+        close(c.sendQueue)
+    }
+    c.lock.Unlock()
+
+    <-c.finished
+    if c.closeErr != nil {
+        return c.closeErr
+    }
+    return shutdownErr
 }
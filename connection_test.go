@@ -1,17 +1,189 @@
 package gocreate
 
 import (
+    "bytes"
+    "context"
+    "errors"
     "github.com/stretchr/testify/assert"
+    "io"
+    "sync"
     "testing"
     "time"
 )
 
+// testDevice is an in-memory stand-in for a serial port which records written data.
+type testDevice struct {
+    lock   sync.Mutex
+    output bytes.Buffer
+    closed chan struct{}
+}
+
+func newTestDevice() *testDevice {
+    return &testDevice{closed: make(chan struct{})}
+}
+
+func (d *testDevice) Read(p []byte) (int, error) {
+    <-d.closed
+    return 0, io.EOF
+}
+
+func (d *testDevice) Write(p []byte) (int, error) {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+    return d.output.Write(p)
+}
+
+func (d *testDevice) Close() error {
+    close(d.closed)
+    return nil
+}
+
+// Written waits for the device to be closed and returns all data written to it.
+func (d *testDevice) Written() []byte {
+    <-d.closed
+    d.lock.Lock()
+    defer d.lock.Unlock()
+    return d.output.Bytes()
+}
+
+// robotTestDevice is a testDevice which imitates a Create's replies to mode changes,
+// sensor requests and baud rate changes.  Data is only understood by the imitation robot
+// when the transport's baud rate matches the robot's.
+type robotTestDevice struct {
+    *testDevice
+    cond      *sync.Cond
+    isClosed  bool
+    rate      uint
+    robotRate uint
+    mode      Mode
+    stubborn  bool
+    input     []byte
+    replies   []byte
+    rates     []uint
+}
+
+func newRobotTestDevice(rate uint) *robotTestDevice {
+    d := &robotTestDevice{testDevice: newTestDevice(), rate: rate, robotRate: rate}
+    d.cond = sync.NewCond(&d.lock)
+    return d
+}
+
+func (d *robotTestDevice) Read(p []byte) (int, error) {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+
+    for len(d.replies) == 0 && !d.isClosed {
+        d.cond.Wait()
+    }
+    if len(d.replies) == 0 {
+        return 0, io.EOF
+    }
+    n := copy(p, d.replies)
+    d.replies = d.replies[n:]
+    return n, nil
+}
+
+func (d *robotTestDevice) Write(p []byte) (int, error) {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+
+    d.output.Write(p)
+    if d.rate != d.robotRate {
+        return len(p), nil
+    }
+
+    d.input = append(d.input, p...)
+    lengths := map[byte]int{128: 1, 129: 2, 131: 1, 132: 1, 136: 2, 137: 5, 139: 4, 141: 2, 142: 2, 145: 5}
+    for len(d.input) > 0 {
+        length, ok := lengths[d.input[0]]
+        if !ok {
+            d.input = d.input[1:]
+            continue
+        }
+        if len(d.input) < length {
+            break
+        }
+
+        switch d.input[0] {
+        case 128:
+            d.mode = ModePassive
+        case 129:
+            for _, r := range []uint{300, 600, 1200, 2400, 4800, 9600, 14400, 19200, 28800, 38400, 57600, 115200} {
+                if Baud(r).Assemble()[1] == d.input[1] && !d.stubborn {
+                    d.robotRate = r
+                }
+            }
+        case 131:
+            d.mode = ModeSafe
+        case 132:
+            d.mode = ModeFull
+        case 142:
+            packet := SensorPacket(d.input[1])
+            if packet == PacketOIMode {
+                d.replies = append(d.replies, byte(d.mode))
+            } else {
+                d.replies = append(d.replies, make([]byte, packet.Size())...)
+            }
+        }
+        d.input = d.input[length:]
+    }
+    d.cond.Broadcast()
+    return len(p), nil
+}
+
+func (d *robotTestDevice) SetBaud(rate uint) error {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+
+    d.rate = rate
+    d.rates = append(d.rates, rate)
+    return nil
+}
+
+func (d *robotTestDevice) Close() error {
+    d.lock.Lock()
+    d.isClosed = true
+    d.lock.Unlock()
+    d.cond.Broadcast()
+    return d.testDevice.Close()
+}
+
+// blockingTestDevice is a testDevice whose writes block until released.
+type blockingTestDevice struct {
+    *testDevice
+    writing chan struct{}
+    release chan struct{}
+}
+
+func newBlockingTestDevice() *blockingTestDevice {
+    return &blockingTestDevice{testDevice: newTestDevice(), writing: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (d *blockingTestDevice) Write(p []byte) (int, error) {
+    d.writing <- struct{}{}
+    <-d.release
+    return d.testDevice.Write(p)
+}
+
+// failingTestDevice is a testDevice whose writes always fail.
+type failingTestDevice struct {
+    *testDevice
+}
+
+func (d *failingTestDevice) Write(p []byte) (int, error) {
+    return 0, errors.New("write failed")
+}
+
+func newTestConnection() (*Connection, *testDevice) {
+    dev := newTestDevice()
+    return NewConnection(dev, 57600), dev
+}
+
 func TestBlink(t *testing.T) {
-    conn := Connect("/dev/tty.usbserial-A100eMiV", 57600)
-    if !assert.NotNil(t, conn) {
+    conn, log, err := NewDryRun()
+    if !assert.Nil(t, err) {
         return
     }
-    defer conn.Close()
 
     var cmds []Command
     cmd := Start()
@@ -26,45 +198,233 @@ func TestBlink(t *testing.T) {
     assert.NotNil(t, cmd)
     cmds = append(cmds, cmd)
 
-    conn.SendMany(cmds)
-    time.Sleep(2 * time.Second)
+    ctx := context.Background()
+    assert.Nil(t, conn.SendMany(ctx, cmds))
 
     cmd = Leds(false, true, 255, 255)
     assert.NotNil(t, cmd)
-    conn.Send(cmd)
-    time.Sleep(2 * time.Second)
+    assert.Nil(t, conn.Send(ctx, cmd))
 
     cmd = Leds(false, false, 255, 255)
     assert.NotNil(t, cmd)
-    conn.Send(cmd)
-    time.Sleep(2 * time.Second)
+    assert.Nil(t, conn.Send(ctx, cmd))
 
     cmd = Leds(false, false, 128, 255)
     assert.NotNil(t, cmd)
-    conn.Send(cmd)
-    time.Sleep(2 * time.Second)
+    assert.Nil(t, conn.Send(ctx, cmd))
 
     cmd = Leds(false, false, 0, 255)
     assert.NotNil(t, cmd)
-    conn.Send(cmd)
-    time.Sleep(2 * time.Second)
+    assert.Nil(t, conn.Send(ctx, cmd))
 
     cmd = Leds(false, false, 0, 170)
     assert.NotNil(t, cmd)
-    conn.Send(cmd)
-    time.Sleep(2 * time.Second)
+    assert.Nil(t, conn.Send(ctx, cmd))
 
     cmd = Leds(false, false, 0, 85)
     assert.NotNil(t, cmd)
-    conn.Send(cmd)
-    time.Sleep(2 * time.Second)
+    assert.Nil(t, conn.Send(ctx, cmd))
 
     cmd = Leds(false, false, 0, 0)
     assert.NotNil(t, cmd)
-    conn.Send(cmd)
-    time.Sleep(2 * time.Second)
+    assert.Nil(t, conn.Send(ctx, cmd))
 
     cmd = Leds(false, false, 255, 255)
     assert.NotNil(t, cmd)
-    conn.Send(cmd)
+    assert.Nil(t, conn.Send(ctx, cmd))
+
+    assert.Nil(t, conn.Close())
+    expected := []byte{
+        128, 132, 139, 0x0A, 255, 255,
+        139, 0x02, 255, 255,
+        139, 0x00, 255, 255,
+        139, 0x00, 128, 255,
+        139, 0x00, 0, 255,
+        139, 0x00, 0, 170,
+        139, 0x00, 0, 85,
+        139, 0x00, 0, 0,
+        139, 0x00, 255, 255,
+    }
+    assert.Equal(t, log.Bytes(), expected, "Transmitted data is incorrect")
+
+    sent, err := log.Commands()
+    assert.Nil(t, err)
+    assert.Len(t, sent, 11)
+}
+
+func TestQuery(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    conn := NewConnection(dev, 57600)
+    ctx := context.Background()
+
+    assert.Nil(t, conn.Send(ctx, Start()))
+    reply, err := conn.Query(ctx, PacketOIMode)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{byte(ModePassive)})
+
+    reply, err = conn.Query(ctx, PacketGroup0)
+    assert.Nil(t, err)
+    assert.Len(t, reply, 26)
+
+    _, err = conn.Query(ctx, SensorPacket(100))
+    assert.Equal(t, err, ErrInvalidCommand)
+    assert.Nil(t, conn.Close())
+}
+
+func TestQueryContext(t *testing.T) {
+    conn, _ := newTestConnection()
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+
+    start := time.Now()
+    _, err := conn.Query(ctx, PacketOIMode)
+    assert.Equal(t, err, context.DeadlineExceeded)
+    assert.True(t, time.Since(start) < sensorTimeout*time.Millisecond, "Expected Query to return when its context expires")
+    assert.Nil(t, conn.Close())
+}
+
+func TestQueryNoResponse(t *testing.T) {
+    conn, _ := newTestConnection()
+    defer conn.Close()
+
+    _, err := conn.Query(context.Background(), PacketOIMode)
+    assert.Equal(t, err, ErrNoResponse, "Expected a request to a silent device to fail")
+}
+
+func TestSendInvalid(t *testing.T) {
+    conn, _ := newTestConnection()
+    defer conn.Close()
+
+    err := conn.Send(context.Background(), Drive(1000, 0))
+    assert.Equal(t, err, ErrInvalidCommand, "Expected sending a nil command to fail")
+}
+
+func TestSendAfterClose(t *testing.T) {
+    conn, dev := newTestConnection()
+    assert.Nil(t, conn.Close())
+    assert.Nil(t, conn.Close(), "Expected closing twice to succeed")
+
+    err := conn.Send(context.Background(), Start())
+    assert.Equal(t, err, ErrClosed, "Expected sending on a closed connection to fail")
+    err = conn.SendMany(context.Background(), []Command{Start(), Safe()})
+    assert.Equal(t, err, ErrClosed, "Expected sending on a closed connection to fail")
+    assert.Empty(t, dev.Written())
+}
+
+func TestSendWriteError(t *testing.T) {
+    conn := NewConnection(&failingTestDevice{newTestDevice()}, 57600)
+    defer conn.Close()
+
+    err := conn.Send(context.Background(), Start())
+    assert.EqualError(t, err, "write failed")
+    err = conn.SendMany(context.Background(), []Command{Start(), Safe()})
+    assert.EqualError(t, err, "write failed")
+}
+
+func TestSendCancelled(t *testing.T) {
+    dev := newBlockingTestDevice()
+    conn := NewConnection(dev, 57600)
+
+    first := make(chan error, 1)
+    go func() {
+        first <- conn.Send(context.Background(), Start())
+    }()
+    <-dev.writing
+
+    // The second command times out while the first is still being written, so it is
+    // discarded rather than sent.
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+    defer cancel()
+    err := conn.Send(ctx, Safe())
+    assert.Equal(t, err, context.DeadlineExceeded)
+
+    close(dev.release)
+    assert.Nil(t, <-first)
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, dev.Written(), []byte{128}, "Expected the cancelled command to be discarded")
+}
+
+func TestCloseFlushes(t *testing.T) {
+    dev := newBlockingTestDevice()
+    conn := NewConnection(dev, 57600)
+
+    sent := make(chan error, 2)
+    go func() {
+        sent <- conn.Send(context.Background(), Start())
+    }()
+    <-dev.writing
+    go func() {
+        sent <- conn.Send(context.Background(), Full())
+    }()
+
+    closed := make(chan error)
+    go func() {
+        // Wait for the second command to be queued before closing.
+        for len(conn.sendQueue) == 0 {
+            time.Sleep(time.Millisecond)
+        }
+        closed <- conn.Close()
+    }()
+
+    select {
+    case <-closed:
+        t.Error("Expected Close to wait for queued commands to be written")
+    case <-time.After(20 * time.Millisecond):
+    }
+
+    close(dev.release)
+    assert.Nil(t, <-closed)
+    assert.Nil(t, <-sent)
+    assert.Nil(t, <-sent)
+    assert.Equal(t, dev.Written(), []byte{128, 132})
+}
+
+func TestConcurrentUse(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    conn := NewConnection(dev, 57600)
+    ctx := context.Background()
+    assert.Nil(t, conn.Send(ctx, Start()))
+
+    var wg sync.WaitGroup
+    errs := make(chan error, 1000)
+    run := func(action func() error) {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := 0; i < 20; i++ {
+                errs <- action()
+            }
+        }()
+    }
+
+    run(func() error { return conn.Send(ctx, Leds(true, false, 0, 255)) })
+    run(func() error { return conn.SendMany(ctx, []Command{Full(), DriveStraight(100), DriveStraight(0)}) })
+    run(func() error {
+        _, err := conn.Query(ctx, PacketOIMode)
+        return err
+    })
+    run(func() error {
+        if conn.CurrentBaud() == 57600 {
+            return conn.SetBaud(ctx, 115200)
+        }
+        return conn.SetBaud(ctx, 57600)
+    })
+    run(func() error {
+        conn.Stats()
+        conn.Status()
+        conn.Port()
+        conn.CurrentPacing()
+        return nil
+    })
+
+    time.Sleep(20 * time.Millisecond)
+    assert.Nil(t, conn.Close())
+    wg.Wait()
+    close(errs)
+
+    for err := range errs {
+        if err != nil && err != ErrClosed {
+            t.Errorf("Unexpected error from concurrent use: %v", err)
+        }
+    }
 }
@@ -0,0 +1,141 @@
+package gocreate
+
+import (
+    "context"
+    "io"
+    "path/filepath"
+    "sort"
+    "sync"
+)
+
+// serialPatterns are the patterns, relative to the device directory, of serial devices
+// which may have a Create attached.  Stable by-id names come first so that they are
+// preferred over the kernel names they link to.
+var serialPatterns = []string{"serial/by-id/*", "ttyUSB*", "ttyACM*"}
+
+// openTransport opens the serial device used by Open.
+var openTransport = func(port string, baud uint) (io.ReadWriteCloser, error) {
+    return openSerialPort(port, baud)
+}
+
+// FindPorts lists the serial devices on a Linux system which may have a Create
+// attached: USB serial adapters (/dev/ttyUSB*) and USB modems (/dev/ttyACM*).  Devices
+// with a stable name in /dev/serial/by-id are listed by that name instead of their
+// kernel name, and each device is only listed once.
+func FindPorts() ([]string, error) {
+    return findPorts("/dev")
+}
+
+func findPorts(root string) ([]string, error) {
+    var ports []string
+    seen := make(map[string]bool)
+    for _, pattern := range serialPatterns {
+        matches, err := filepath.Glob(filepath.Join(root, pattern))
+        if err != nil {
+            return nil, err
+        }
+        sort.Strings(matches)
+
+        for _, m := range matches {
+            target, err := filepath.EvalSymlinks(m)
+            if err != nil {
+                continue
+            }
+            if !seen[target] {
+                seen[target] = true
+                ports = append(ports, m)
+            }
+        }
+    }
+    return ports, nil
+}
+
+// stablePort returns the name in /dev/serial/by-id for the given serial port, or the
+// port itself if it has no such name.
+func stablePort(port string) string {
+    return stableName("/dev", port)
+}
+
+func stableName(root string, port string) string {
+    target, err := filepath.EvalSymlinks(port)
+    if err != nil {
+        return port
+    }
+
+    links, _ := filepath.Glob(filepath.Join(root, serialPatterns[0]))
+    for _, link := range links {
+        if t, err := filepath.EvalSymlinks(link); err == nil && t == target {
+            return link
+        }
+    }
+    return port
+}
+
+// PortProbe is the result of probing a serial port for a Create.
+//
+// Baud and Mode are the Create's baud rate and OI mode, and are only valid if Err is
+// nil.
+type PortProbe struct {
+    Port string
+    Baud uint
+    Mode Mode
+    Err  error
+}
+
+// ProbePorts checks each of the given ports for a responsive Create, by detecting its
+// baud rate (see DetectBaud) and then requesting its OI mode.  The ports are probed in
+// parallel, and the results are returned in the same order as the ports.  Note that
+// probing starts the OI, leaving any Create found in Passive mode.
+func ProbePorts(ctx context.Context, ports []string) []PortProbe {
+    results := make([]PortProbe, len(ports))
+    var wg sync.WaitGroup
+    for i, port := range ports {
+        wg.Add(1)
+        go func(i int, port string) {
+            defer wg.Done()
+            results[i] = probePort(ctx, port)
+        }(i, port)
+    }
+    wg.Wait()
+    return results
+}
+
+func probePort(ctx context.Context, port string) PortProbe {
+    result := PortProbe{Port: port}
+    transport, err := openTransport(port, probeRates[0])
+    if err != nil {
+        result.Err = err
+        return result
+    }
+
+    conn := newConnection(port, transport, defaultConfig(probeRates[0]))
+    defer conn.Close()
+
+    if result.Baud, result.Err = conn.DetectBaud(ctx); result.Err != nil {
+        return result
+    }
+    reply, err := conn.Query(ctx, PacketOIMode)
+    if err != nil {
+        result.Err = err
+        return result
+    }
+    result.Mode = Mode(reply[0])
+    return result
+}
+
+// Discover finds the serial ports which have a responsive Create attached, by probing
+// each of the ports listed by FindPorts.
+func Discover(ctx context.Context) ([]PortProbe, error) {
+    ports, err := FindPorts()
+    if err != nil {
+        return nil, err
+    }
+
+    var found []PortProbe
+    for _, p := range ProbePorts(ctx, ports) {
+        if p.Err == nil {
+            found = append(found, p)
+        }
+    }
+    return found, nil
+}
@@ -0,0 +1,62 @@
+package gocreate
+
+import (
+    "context"
+    "errors"
+    "github.com/stretchr/testify/assert"
+    "io"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestFindPorts(t *testing.T) {
+    root := t.TempDir()
+    assert.Nil(t, os.MkdirAll(filepath.Join(root, "serial", "by-id"), 0755))
+    for _, name := range []string{"ttyUSB0", "ttyUSB1", "ttyACM0", "ttyS0"} {
+        assert.Nil(t, os.WriteFile(filepath.Join(root, name), nil, 0644))
+    }
+    byID := filepath.Join(root, "serial", "by-id", "usb-FTDI_FT231X_USB_UART_DN0001-if00-port0")
+    assert.Nil(t, os.Symlink(filepath.Join(root, "ttyUSB0"), byID))
+
+    ports, err := findPorts(root)
+    assert.Nil(t, err)
+    assert.Equal(t, ports, []string{byID, filepath.Join(root, "ttyUSB1"), filepath.Join(root, "ttyACM0")},
+        "Expected by-id names to be preferred and other serial devices to be ignored")
+}
+
+func TestFindPortsEmpty(t *testing.T) {
+    ports, err := findPorts(t.TempDir())
+    assert.Nil(t, err)
+    assert.Empty(t, ports)
+}
+
+func TestProbePorts(t *testing.T) {
+    robot := newRobotTestDevice(57600)
+    robot.robotRate = 19200
+    silent := newRobotTestDevice(57600)
+    silent.robotRate = 0
+
+    open := openTransport
+    defer func() { openTransport = open }()
+    openTransport = func(port string, baud uint) (io.ReadWriteCloser, error) {
+        switch port {
+        case "robot":
+            return robot, nil
+        case "silent":
+            return silent, nil
+        }
+        return nil, errors.New("No such device")
+    }
+
+    results := ProbePorts(context.Background(), []string{"missing", "robot", "silent"})
+    if !assert.Len(t, results, 3) {
+        return
+    }
+    assert.Equal(t, results[0].Port, "missing")
+    assert.NotNil(t, results[0].Err, "Expected a port which cannot be opened to fail")
+    assert.Equal(t, results[1], PortProbe{Port: "robot", Baud: 19200, Mode: ModePassive})
+    assert.Equal(t, results[2].Port, "silent")
+    assert.NotNil(t, results[2].Err, "Expected a port with nothing attached to fail")
+    assert.True(t, robot.isClosed, "Expected the probed port to be closed")
+}
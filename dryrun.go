@@ -0,0 +1,148 @@
+package gocreate
+
+import (
+    "io"
+    "sync"
+)
+
+// DryRunLog is an in-memory transport which records everything written to it, so that
+// applications and tests can run without a Create.  It answers sensor requests with
+// zeroes, except for the OI mode, which follows the mode commands written, so that every
+// Connection call succeeds.  It implements BaudSetter, and records the baud rate.
+type DryRunLog struct {
+    lock    sync.Mutex
+    cond    *sync.Cond
+    data    []byte
+    input   []byte
+    replies []byte
+    mode    Mode
+    baud    uint
+    closed  bool
+}
+
+// NewDryRunLog creates an empty dry-run transport.
+func NewDryRunLog() *DryRunLog {
+    d := &DryRunLog{}
+    d.cond = sync.NewCond(&d.lock)
+    return d
+}
+
+// NewDryRun opens a connection, configured by the given options, which writes to a new
+// dry-run transport instead of a serial port.
+func NewDryRun(opts ...Option) (*Connection, *DryRunLog, error) {
+    log := NewDryRunLog()
+    conn, err := Open("", append(opts, WithTransport(log))...)
+    if err != nil {
+        return nil, nil, err
+    }
+    return conn, log, nil
+}
+
+// Read returns the replies to sensor requests, blocking until there are some.
+func (d *DryRunLog) Read(p []byte) (int, error) {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+
+    for len(d.replies) == 0 && !d.closed {
+        d.cond.Wait()
+    }
+    if len(d.replies) == 0 {
+        return 0, io.EOF
+    }
+    n := copy(p, d.replies)
+    d.replies = d.replies[n:]
+    return n, nil
+}
+
+// Write records data, and prepares replies to any sensor requests it contains.
+func (d *DryRunLog) Write(p []byte) (int, error) {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+
+    if d.closed {
+        return 0, io.ErrClosedPipe
+    }
+    d.data = append(d.data, p...)
+    d.input = append(d.input, p...)
+    for len(d.input) > 0 {
+        length, ok := commandLength(d.input)
+        if !ok {
+            d.input = d.input[1:]
+            continue
+        }
+        if length == 0 || length > len(d.input) {
+            break
+        }
+        d.respond(d.input[:length])
+        d.input = d.input[length:]
+    }
+    d.cond.Broadcast()
+    return len(p), nil
+}
+
+func (d *DryRunLog) respond(cmd []byte) {
+    if mode, ok := commandedMode(cmd[0]); ok {
+        d.mode = mode
+    }
+
+    switch cmd[0] {
+    case 142:
+        d.reply(SensorPacket(cmd[1]))
+    case 149:
+        for _, p := range cmd[2:] {
+            d.reply(SensorPacket(p))
+        }
+    }
+}
+
+func (d *DryRunLog) reply(packet SensorPacket) {
+    if packet == PacketOIMode {
+        d.replies = append(d.replies, byte(d.mode))
+    } else {
+        d.replies = append(d.replies, make([]byte, packet.Size())...)
+    }
+}
+
+// Close stops any pending Read.  The recorded data remains available.
+func (d *DryRunLog) Close() error {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+
+    d.closed = true
+    d.cond.Broadcast()
+    return nil
+}
+
+// SetBaud records the baud rate.
+func (d *DryRunLog) SetBaud(rate uint) error {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+    d.baud = rate
+    return nil
+}
+
+// Baud returns the last baud rate set, or 0 if it has not been changed.
+func (d *DryRunLog) Baud() uint {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+    return d.baud
+}
+
+// Bytes returns a copy of all the data written so far.
+func (d *DryRunLog) Bytes() []byte {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+    return append([]byte(nil), d.data...)
+}
+
+// Commands decodes the data written so far back into commands (see ParseCommands).
+func (d *DryRunLog) Commands() ([]Command, error) {
+    return ParseCommands(d.Bytes())
+}
+
+// Reset discards the data written so far.
+func (d *DryRunLog) Reset() {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+    d.data = nil
+}
@@ -0,0 +1,50 @@
+package gocreate
+
+import (
+    "context"
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestDryRun(t *testing.T) {
+    conn, log, err := NewDryRun(WithStartMode(ModeFull))
+    if !assert.Nil(t, err) {
+        return
+    }
+    ctx := context.Background()
+
+    reply, err := conn.Query(ctx, PacketOIMode)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{byte(ModeFull)}, "Expected the mode reply to follow the mode commands")
+    reply, err = conn.Query(ctx, PacketDistance)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{0, 0})
+
+    assert.Nil(t, conn.SetBaud(ctx, 115200))
+    assert.Equal(t, log.Baud(), uint(115200))
+    assert.Nil(t, conn.Send(ctx, DriveDirect(100, 100)))
+    assert.Nil(t, conn.Close())
+
+    assert.Equal(t, log.Bytes(), []byte{128, 132, 142, 35, 142, 19, 129, 11, 142, 35, 145, 0, 100, 0, 100})
+    cmds, err := log.Commands()
+    assert.Nil(t, err)
+    names := make([]string, len(cmds))
+    for i, cmd := range cmds {
+        names[i] = CommandName(cmd)
+    }
+    assert.Equal(t, names, []string{"Start", "Full", "Sensors", "Sensors", "Baud", "Sensors", "Drive Direct"})
+
+    log.Reset()
+    assert.Empty(t, log.Bytes())
+    assert.NotNil(t, conn.Send(ctx, Start()))
+}
+
+func TestDryRunDetectBaud(t *testing.T) {
+    conn, log, err := NewDryRun(WithBaud(0))
+    if !assert.Nil(t, err) {
+        return
+    }
+    assert.Equal(t, conn.CurrentBaud(), uint(57600))
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, log.Bytes(), []byte{128, 142, 35})
+}
@@ -0,0 +1,235 @@
+package gocreate
+
+import (
+    "context"
+    "errors"
+    "sort"
+    "sync"
+    "time"
+)
+
+var (
+    // ErrDuplicateRobot is returned when adding a robot to a fleet under a name which is
+    // already in use.
+    ErrDuplicateRobot = errors.New("Robot name is already in use")
+    // ErrUnknownRobot is reported for a robot name which is not part of the fleet.
+    ErrUnknownRobot = errors.New("Unknown robot")
+)
+
+// Fleet manages the connections to a group of Creates by name, so that they can be
+// monitored and commanded together.  It is safe for concurrent use.
+type Fleet struct {
+    lock   sync.RWMutex
+    robots map[string]*Connection
+}
+
+// RobotHealth describes the state of one robot in a fleet.
+//
+// Mode is the OI mode reported by the robot, and Latency is the time taken for it to
+// reply.  Both are only valid if Err is nil.
+//
+// Stopped reports whether the robot's connection is in the emergency stopped state (see
+// EmergencyStop), and Stats is a snapshot of its link statistics.
+type RobotHealth struct {
+    Name    string
+    Mode    Mode
+    Latency time.Duration
+    Stopped bool
+    Stats   Stats
+    Err     error
+}
+
+// NewFleet creates an empty fleet.
+func NewFleet() *Fleet {
+    return &Fleet{robots: make(map[string]*Connection)}
+}
+
+// Add places a connection in the fleet under the given name.
+func (f *Fleet) Add(name string, conn *Connection) error {
+    if conn == nil {
+        return errors.New("Connection is nil")
+    }
+
+    f.lock.Lock()
+    defer f.lock.Unlock()
+
+    if _, ok := f.robots[name]; ok {
+        return ErrDuplicateRobot
+    }
+    f.robots[name] = conn
+    return nil
+}
+
+// Remove takes the named robot out of the fleet and returns its connection, or nil if
+// there is no such robot.  The connection is not closed.
+func (f *Fleet) Remove(name string) *Connection {
+    f.lock.Lock()
+    defer f.lock.Unlock()
+
+    conn := f.robots[name]
+    delete(f.robots, name)
+    return conn
+}
+
+// Get returns the connection for the named robot, or nil if there is no such robot.
+func (f *Fleet) Get(name string) *Connection {
+    f.lock.RLock()
+    defer f.lock.RUnlock()
+    return f.robots[name]
+}
+
+// Names returns the names of the robots in the fleet, in sorted order.
+func (f *Fleet) Names() []string {
+    f.lock.RLock()
+    defer f.lock.RUnlock()
+
+    names := make([]string, 0, len(f.robots))
+    for name := range f.robots {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// pick returns the connections for the named robots, or for every robot if no names
+// are given.  Names which are not part of the fleet map to nil.
+func (f *Fleet) pick(names []string) map[string]*Connection {
+    f.lock.RLock()
+    defer f.lock.RUnlock()
+
+    picked := make(map[string]*Connection)
+    if len(names) == 0 {
+        for name, conn := range f.robots {
+            picked[name] = conn
+        }
+    }
+    for _, name := range names {
+        picked[name] = f.robots[name]
+    }
+    return picked
+}
+
+// each runs an action for each of the named robots in parallel, and collects the
+// results.  Unknown robots are given ErrUnknownRobot without running the action.
+func (f *Fleet) each(names []string, action func(name string, conn *Connection) error) map[string]error {
+    picked := f.pick(names)
+    results := make(map[string]error, len(picked))
+
+    var lock sync.Mutex
+    var wg sync.WaitGroup
+    for name, conn := range picked {
+        if conn == nil {
+            lock.Lock()
+            results[name] = ErrUnknownRobot
+            lock.Unlock()
+            continue
+        }
+
+        wg.Add(1)
+        go func(name string, conn *Connection) {
+            defer wg.Done()
+            err := action(name, conn)
+
+            lock.Lock()
+            results[name] = err
+            lock.Unlock()
+        }(name, conn)
+    }
+    wg.Wait()
+    return results
+}
+
+// Health checks each robot in the fleet by requesting its OI mode, and reports the
+// results in order of name.
+func (f *Fleet) Health(ctx context.Context) []RobotHealth {
+    var lock sync.Mutex
+    health := make(map[string]RobotHealth)
+    f.each(nil, func(name string, conn *Connection) error {
+        h := RobotHealth{Name: name, Stopped: conn.Stopped()}
+        start := time.Now()
+        reply, err := conn.Query(ctx, PacketOIMode)
+        h.Stats = conn.Stats()
+        if err == nil && len(reply) == 0 {
+            err = ErrNoResponse
+        }
+        if err == nil {
+            h.Mode = Mode(reply[0])
+            h.Latency = time.Since(start)
+        }
+        h.Err = err
+
+        lock.Lock()
+        health[name] = h
+        lock.Unlock()
+        return err
+    })
+
+    report := make([]RobotHealth, 0, len(health))
+    for _, h := range health {
+        report = append(report, h)
+    }
+    sort.Slice(report, func(i, j int) bool { return report[i].Name < report[j].Name })
+    return report
+}
+
+// Broadcast sends the same sequence of commands to the named robots, or to every robot
+// in the fleet if no names are given.  Each robot starts sending at the given time, so
+// that their actions are synchronised, for example for a choreographed dance; a zero
+// start time starts immediately.  The start is synchronised to within the scheduling
+// and queueing delays of each connection, so the robots' queues should be idle.
+//
+// Each robot receives the commands as a single contiguous write (see SendMany), so a
+// Baud command can only be broadcast on its own.  Sensor requests cannot be broadcast at
+// all, as each has a single reply channel.  Either mistake makes the broadcast fail with
+// ErrUnbatchable for every robot before anything is sent.  The result maps each robot's
+// name to the error from sending to it, which is nil on success.
+func (f *Fleet) Broadcast(ctx context.Context, start time.Time, cmds []Command, names ...string) map[string]error {
+    invalid := checkBroadcast(cmds)
+    return f.each(names, func(name string, conn *Connection) error {
+        if invalid != nil {
+            return invalid
+        }
+        if delay := time.Until(start); !start.IsZero() && delay > 0 {
+            timer := time.NewTimer(delay)
+            defer timer.Stop()
+
+            select {
+            case <-timer.C:
+            case <-ctx.Done():
+                return ctx.Err()
+            }
+        }
+        return conn.SendMany(ctx, cmds)
+    })
+}
+
+// checkBroadcast checks that a sequence of commands can be sent to several robots.
+func checkBroadcast(cmds []Command) error {
+    for _, cmd := range cmds {
+        if cmd != nil && expectsResponse(cmd) {
+            return ErrUnbatchable
+        }
+    }
+    if len(cmds) > 1 {
+        _, err := newBatch(cmds)
+        return err
+    }
+    return nil
+}
+
+// Close closes the connections of every robot in the fleet and removes them from it.
+// The first error encountered is returned.
+func (f *Fleet) Close() error {
+    f.lock.Lock()
+    robots := f.robots
+    f.robots = make(map[string]*Connection)
+    f.lock.Unlock()
+
+    var first error
+    for _, conn := range robots {
+        if err := conn.Close(); err != nil && first == nil {
+            first = err
+        }
+    }
+    return first
+}
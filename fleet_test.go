@@ -0,0 +1,120 @@
+package gocreate
+
+import (
+    "context"
+    "github.com/stretchr/testify/assert"
+    "testing"
+    "time"
+)
+
+func TestFleetMembership(t *testing.T) {
+    fleet := NewFleet()
+    alpha, _ := newTestConnection()
+    beta, _ := newTestConnection()
+
+    assert.Nil(t, fleet.Add("beta", beta))
+    assert.Nil(t, fleet.Add("alpha", alpha))
+    assert.Equal(t, fleet.Add("alpha", beta), ErrDuplicateRobot)
+    assert.NotNil(t, fleet.Add("gamma", nil))
+    assert.Equal(t, fleet.Names(), []string{"alpha", "beta"})
+    assert.True(t, fleet.Get("alpha") == alpha)
+    assert.Nil(t, fleet.Get("gamma"))
+
+    assert.True(t, fleet.Remove("beta") == beta)
+    assert.Nil(t, fleet.Remove("beta"))
+    assert.Equal(t, fleet.Names(), []string{"alpha"})
+
+    assert.Nil(t, fleet.Close())
+    assert.Empty(t, fleet.Names())
+    assert.Equal(t, alpha.Send(context.Background(), Start()), ErrClosed)
+    assert.Nil(t, beta.Close())
+}
+
+func TestFleetBroadcast(t *testing.T) {
+    fleet := NewFleet()
+    alpha, alphaDev := newTestConnection()
+    beta, betaDev := newTestConnection()
+    gamma, gammaDev := newTestConnection()
+    assert.Nil(t, fleet.Add("alpha", alpha))
+    assert.Nil(t, fleet.Add("beta", beta))
+    assert.Nil(t, fleet.Add("gamma", gamma))
+
+    start := time.Now().Add(50 * time.Millisecond)
+    cmds := []Command{Start(), Full(), DriveDirect(100, -100)}
+    results := fleet.Broadcast(context.Background(), start, cmds)
+    assert.True(t, !time.Now().Before(start), "Expected the broadcast to wait for the start time")
+    assert.Equal(t, results, map[string]error{"alpha": nil, "beta": nil, "gamma": nil})
+
+    results = fleet.Broadcast(context.Background(), time.Time{}, []Command{Start()}, "beta", "delta")
+    assert.Equal(t, results, map[string]error{"beta": nil, "delta": ErrUnknownRobot})
+
+    results = fleet.Broadcast(context.Background(), start, []Command{Start(), Sensors(PacketOIMode)}, "alpha", "gamma")
+    assert.Equal(t, results, map[string]error{"alpha": ErrUnbatchable, "gamma": ErrUnbatchable}, "Expected sensor requests to be refused")
+    results = fleet.Broadcast(context.Background(), start, []Command{Sensors(PacketOIMode)}, "alpha")
+    assert.Equal(t, results, map[string]error{"alpha": ErrUnbatchable}, "Expected a lone sensor request to be refused")
+    results = fleet.Broadcast(context.Background(), start, []Command{Leds(true, false, 0, 0), Baud(19200)}, "alpha")
+    assert.Equal(t, results, map[string]error{"alpha": ErrUnbatchable}, "Expected a Baud command in a sequence to be refused")
+
+    assert.Nil(t, fleet.Close())
+    expected := []byte{128, 132, 145, 0, 100, 255, 156}
+    assert.Equal(t, alphaDev.Written(), expected)
+    assert.Equal(t, betaDev.Written(), append(expected, 128))
+    assert.Equal(t, gammaDev.Written(), expected)
+}
+
+func TestFleetBroadcastBaud(t *testing.T) {
+    fleet := NewFleet()
+    dev := newRobotTestDevice(57600)
+    conn := NewConnection(dev, 57600)
+    assert.Nil(t, fleet.Add("alpha", conn))
+
+    results := fleet.Broadcast(context.Background(), time.Time{}, []Command{Baud(19200)})
+    assert.Equal(t, results, map[string]error{"alpha": nil}, "Expected a lone Baud command to be sent")
+    assert.Equal(t, conn.CurrentBaud(), uint(19200))
+    assert.Nil(t, fleet.Close())
+}
+
+func TestFleetBroadcastCancel(t *testing.T) {
+    fleet := NewFleet()
+    alpha, alphaDev := newTestConnection()
+    assert.Nil(t, fleet.Add("alpha", alpha))
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+    defer cancel()
+    results := fleet.Broadcast(ctx, time.Now().Add(time.Hour), []Command{Start()})
+    assert.Equal(t, results, map[string]error{"alpha": context.DeadlineExceeded})
+
+    assert.Nil(t, fleet.Close())
+    assert.Empty(t, alphaDev.Written(), "Expected nothing to be sent before the start time")
+}
+
+func TestFleetHealth(t *testing.T) {
+    fleet := NewFleet()
+    full := newRobotTestDevice(57600)
+    full.mode = ModeFull
+    passive := newRobotTestDevice(57600)
+    silent := newRobotTestDevice(57600)
+    silent.robotRate = 0
+    assert.Nil(t, fleet.Add("full", NewConnection(full, 57600)))
+    assert.Nil(t, fleet.Add("passive", NewConnection(passive, 57600)))
+    assert.Nil(t, fleet.Add("silent", NewConnection(silent, 57600)))
+    fleet.Get("passive").EmergencyStop(Start())
+
+    health := fleet.Health(context.Background())
+    if !assert.Len(t, health, 3) {
+        return
+    }
+    assert.Equal(t, health[0].Name, "full")
+    assert.Nil(t, health[0].Err)
+    assert.Equal(t, health[0].Mode, ModeFull)
+    assert.False(t, health[0].Stopped)
+    assert.Equal(t, health[1].Name, "passive")
+    assert.Nil(t, health[1].Err)
+    assert.Equal(t, health[1].Mode, ModePassive)
+    assert.True(t, health[1].Stopped)
+    assert.Equal(t, health[2].Name, "silent")
+    assert.NotNil(t, health[2].Err, "Expected a robot which does not reply to be unhealthy")
+    assert.Equal(t, health[2].Stats.Timeouts, uint64(1))
+
+    assert.Nil(t, fleet.Close())
+}
@@ -0,0 +1,140 @@
+package gocreate
+
+import (
+    "context"
+    "time"
+)
+
+// Status describes whether the Create appears to be alive, based on its replies to
+// sensor requests.
+type Status int
+
+const (
+    // StatusUnknown indicates that the Create has not replied to any sensor request yet.
+    StatusUnknown Status = iota
+    // StatusAlive indicates that the Create is replying as expected.
+    StatusAlive
+    // StatusUnresponsive indicates that the Create has stopped replying, for example
+    // because it has been switched off or its battery is flat, or that the link to it is
+    // down.
+    StatusUnresponsive
+    // StatusReset indicates that the Create reported a lower OI mode than the one it was
+    // last commanded to use, for example Off after Full, which means that it has reset.
+    // A Create in Safe mode also falls back to Passive mode by itself when it detects a
+    // cliff or wheel drop.
+    StatusReset
+)
+
+func (s Status) String() string {
+    switch s {
+    case StatusAlive:
+        return "alive"
+    case StatusUnresponsive:
+        return "unresponsive"
+    case StatusReset:
+        return "reset"
+    }
+    return "unknown"
+}
+
+// unresponsiveMisses is the number of consecutive unanswered sensor requests after
+// which the Create is considered unresponsive.
+const unresponsiveMisses = 2
+
+// liveness tracks the Create's replies to sensor requests.
+type liveness struct {
+    replied bool
+    misses  int
+    reset   bool
+}
+
+// Status reports whether the Create appears to be alive.  It is based on the replies to
+// all sensor requests, so it is only up to date if sensors are queried regularly, either
+// by the application or by the heartbeat (see StartHeartbeat).  Replies to OI mode
+// requests are compared with the last mode command written to detect a reset; writing a
+// mode command again clears StatusReset.
+func (c *Connection) Status() Status {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+
+    switch {
+    case c.down || c.liveness.misses >= unresponsiveMisses:
+        return StatusUnresponsive
+    case c.liveness.reset:
+        return StatusReset
+    case c.liveness.replied:
+        return StatusAlive
+    }
+    return StatusUnknown
+}
+
+// replied records a reply, which may be partial, from the Create.
+func (c *Connection) replied(cmd Command, reply []byte) {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+
+    c.liveness.replied = true
+    c.liveness.misses = 0
+    if s, ok := cmd.(*sensorCommand); ok && s.Opcode == 142 && s.Payload[0] == byte(PacketOIMode) && len(reply) == 1 {
+        c.liveness.reset = Mode(reply[0]) < c.oiMode
+    }
+}
+
+// unanswered records a sensor request which received no reply.
+func (c *Connection) unanswered() {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    c.liveness.misses++
+}
+
+// StartHeartbeat begins requesting the OI mode from the Create at the given interval,
+// so that Status detects when it stops replying or resets even if the application does
+// not query any sensors.
+//
+// Starting the heartbeat again replaces the previous interval.  The heartbeat is stopped
+// when the connection is closed.  ErrInvalidInterval is returned if the interval is not
+// positive.
+func (c *Connection) StartHeartbeat(interval time.Duration) error {
+    if interval <= 0 {
+        return ErrInvalidInterval
+    }
+
+    stop := make(chan struct{})
+    c.stateLock.Lock()
+    if c.heartbeat != nil {
+        close(c.heartbeat)
+    }
+    c.heartbeat = stop
+    c.stateLock.Unlock()
+
+    go c.beat(interval, stop)
+    return nil
+}
+
+// StopHeartbeat stops the heartbeat, if it is running.
+func (c *Connection) StopHeartbeat() {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+
+    if c.heartbeat != nil {
+        close(c.heartbeat)
+        c.heartbeat = nil
+    }
+}
+
+func (c *Connection) beat(interval time.Duration, stop chan struct{}) {
+    for {
+        select {
+        case <-stop:
+            return
+        case <-time.After(interval):
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), interval)
+        _, err := c.Query(ctx, PacketOIMode)
+        cancel()
+        if err == ErrClosed {
+            return
+        }
+    }
+}
@@ -0,0 +1,92 @@
+package gocreate
+
+import (
+    "context"
+    "github.com/stretchr/testify/assert"
+    "testing"
+    "time"
+)
+
+func setRobot(dev *robotTestDevice, update func(dev *robotTestDevice)) {
+    dev.lock.Lock()
+    defer dev.lock.Unlock()
+    update(dev)
+}
+
+func waitForStatus(conn *Connection, status Status) bool {
+    deadline := time.Now().Add(time.Second)
+    for time.Now().Before(deadline) {
+        if conn.Status() == status {
+            return true
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    return false
+}
+
+func TestStatus(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    conn := NewConnection(dev, 57600)
+    ctx := context.Background()
+    assert.Equal(t, conn.Status(), StatusUnknown)
+
+    assert.Nil(t, conn.SendMany(ctx, []Command{Start(), Full()}))
+    _, err := conn.Query(ctx, PacketOIMode)
+    assert.Nil(t, err)
+    assert.Equal(t, conn.Status(), StatusAlive)
+
+    setRobot(dev, func(dev *robotTestDevice) { dev.mode = ModeOff })
+    _, err = conn.Query(ctx, PacketOIMode)
+    assert.Nil(t, err)
+    assert.Equal(t, conn.Status(), StatusReset, "Expected Off after Full to be detected as a reset")
+    assert.Nil(t, conn.SendMany(ctx, []Command{Start(), Full()}))
+    assert.Equal(t, conn.Status(), StatusAlive, "Expected the reset to be cleared by commanding the mode")
+
+    setRobot(dev, func(dev *robotTestDevice) { dev.robotRate = 0 })
+    _, err = conn.Query(ctx, PacketOIMode)
+    assert.Equal(t, err, ErrNoResponse)
+    assert.Equal(t, conn.Status(), StatusAlive, "Expected a single missed reply to be tolerated")
+    _, err = conn.Query(ctx, PacketWall)
+    assert.Equal(t, err, ErrNoResponse)
+    assert.Equal(t, conn.Status(), StatusUnresponsive)
+
+    setRobot(dev, func(dev *robotTestDevice) { dev.robotRate = 57600 })
+    _, err = conn.Query(ctx, PacketWall)
+    assert.Nil(t, err)
+    assert.Equal(t, conn.Status(), StatusAlive)
+    assert.Nil(t, conn.Close())
+}
+
+func TestHeartbeat(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    conn, err := Open("robot", WithTransport(dev), WithStartMode(ModeSafe), WithHeartbeat(10*time.Millisecond))
+    if !assert.Nil(t, err) {
+        return
+    }
+
+    assert.True(t, waitForStatus(conn, StatusAlive), "Expected the heartbeat to find the Create alive")
+    setRobot(dev, func(dev *robotTestDevice) { dev.mode = ModePassive })
+    assert.True(t, waitForStatus(conn, StatusReset), "Expected the heartbeat to detect the mode change")
+    setRobot(dev, func(dev *robotTestDevice) { dev.robotRate = 0 })
+    assert.True(t, waitForStatus(conn, StatusUnresponsive), "Expected the heartbeat to detect silence")
+
+    conn.StopHeartbeat()
+    assert.Nil(t, conn.Close())
+}
+
+func TestHeartbeatInterval(t *testing.T) {
+    conn, _ := newTestConnection()
+    assert.Equal(t, conn.StartHeartbeat(0), ErrInvalidInterval)
+    assert.Equal(t, conn.StartHeartbeat(-time.Second), ErrInvalidInterval)
+    assert.Nil(t, conn.Close())
+
+    _, err := Open("robot", WithTransport(newTestDevice()), WithHeartbeat(-time.Second))
+    assert.Equal(t, err, ErrInvalidInterval, "Expected Open to reject the interval")
+}
+
+func TestStatusString(t *testing.T) {
+    assert.Equal(t, StatusUnknown.String(), "unknown")
+    assert.Equal(t, StatusAlive.String(), "alive")
+    assert.Equal(t, StatusUnresponsive.String(), "unresponsive")
+    assert.Equal(t, StatusReset.String(), "reset")
+}
@@ -0,0 +1,169 @@
+package gocreate
+
+import (
+    "errors"
+)
+
+// ErrVetoed is a convenient error for interceptors to return when refusing a command.
+var ErrVetoed = errors.New("Command vetoed by interceptor")
+
+// Interceptor is a function which is called for every command sent with Send or SendMany,
+// in the order the commands are written, before the command is assembled.  It returns
+// the command to write in its place, which may be the same command, a rewritten one, or
+// nil to drop the command silently.  Returning an error vetoes the command, and the error
+// is returned to the sender.  An interceptor may also pass commands on elsewhere, for
+// example to mirror them to another Create.
+//
+// A command which expects a response, such as a sensor request, cannot be dropped or
+// replaced, as the sender is waiting for its reply; doing so vetoes it with ErrVetoed.
+//
+// Interceptors are called from the connection's sender goroutine, so they should return
+// quickly, and they must not call back into the same connection: Send, SendMany, Query,
+// SetBaud, Shutdown and Close all wait for the sender goroutine, so calling them from an
+// interceptor deadlocks.  Commands written internally, such as those used to detect or
+// change the baud rate, EmergencyStop and Shutdown, are not intercepted.
+type Interceptor func(cmd Command) (Command, error)
+
+type interceptorEntry struct {
+    id          int
+    interceptor Interceptor
+}
+
+// AddInterceptor adds an interceptor to the end of the connection's chain.  Each
+// interceptor sees the command returned by the one before it.  The returned function
+// removes the interceptor again.
+func (c *Connection) AddInterceptor(interceptor Interceptor) (remove func()) {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+
+    c.nextID++
+    id := c.nextID
+    c.chain = append(c.chain, interceptorEntry{id: id, interceptor: interceptor})
+
+    return func() {
+        c.stateLock.Lock()
+        defer c.stateLock.Unlock()
+
+        for i, e := range c.chain {
+            if e.id == id {
+                c.chain = append(c.chain[:i:i], c.chain[i+1:]...)
+                return
+            }
+        }
+    }
+}
+
+// intercept passes a command through the interceptor chain.  The commands in a batch are
+// intercepted individually, and the batch is vetoed if any of them is.
+func (c *Connection) intercept(cmd Command) (Command, error) {
+    c.stateLock.Lock()
+    chain := c.chain
+    c.stateLock.Unlock()
+
+    if len(chain) == 0 {
+        return cmd, nil
+    }
+
+    batch, ok := cmd.(*batchCommand)
+    if !ok {
+        intercepted, err := runChain(chain, cmd)
+        if err == nil && intercepted != cmd && expectsResponse(cmd) {
+            return nil, ErrVetoed
+        }
+        return intercepted, err
+    }
+
+    var cmds []Command
+    for _, part := range batch.Commands {
+        part, err := runChain(chain, part)
+        if err != nil {
+            return nil, err
+        }
+        if part != nil {
+            cmds = append(cmds, part)
+        }
+    }
+    if len(cmds) == 0 {
+        return nil, nil
+    }
+    return newBatch(cmds)
+}
+
+func runChain(chain []interceptorEntry, cmd Command) (Command, error) {
+    for _, e := range chain {
+        var err error
+        if cmd, err = e.interceptor(cmd); err != nil || cmd == nil {
+            return nil, err
+        }
+    }
+    return cmd, nil
+}
+
+// decodeVelocities extracts the two signed 16-bit values from a Drive or Drive Direct
+// command: the velocity and radius, or the right and left velocities.
+func decodeVelocities(cmd Command) (opcode byte, first int16, second int16, ok bool) {
+    s, ok := cmd.(*simpleCommand)
+    if !ok || !isMotion(s) || len(s.Payload) != 4 {
+        return 0, 0, 0, false
+    }
+    first = int16(uint16(s.Payload[0])<<8 | uint16(s.Payload[1]))
+    second = int16(uint16(s.Payload[2])<<8 | uint16(s.Payload[3]))
+    return s.Opcode, first, second, true
+}
+
+// LimitSpeed returns an interceptor which limits the wheel speeds of motion commands
+// generated by Drive, DriveStraight, Spin and DriveDirect to the given maximum in mm/s.
+// A Drive command keeps its turn radius, with its velocity reduced so that the outer
+// wheel, which is faster than the centre of the Create on a curve, is within the limit.
+// A Drive Direct command has both wheel velocities scaled by the same factor.  Either
+// way, the Create follows the same path more slowly.  Other commands are passed through
+// unchanged.
+func LimitSpeed(max int16) Interceptor {
+    if max < 0 {
+        max = 0
+    }
+
+    return func(cmd Command) (Command, error) {
+        opcode, first, second, ok := decodeVelocities(cmd)
+        if !ok {
+            return cmd, nil
+        }
+
+        if opcode == 137 {
+            // The outer wheel's speed is |v| * (|r| + b/2) / |r|, except when driving
+            // straight or spinning on the spot.
+            limit := int32(max)
+            if radius := int32(abs(second)); second != -32768 && radius != 32767 && radius != 1 {
+                limit = limit * radius / (radius + wheelBase/2)
+            }
+            if int32(abs(first)) <= limit {
+                return cmd, nil
+            }
+            velocity := int16(limit)
+            if first < 0 {
+                velocity = -velocity
+            }
+            payload := cmd.(*simpleCommand).Payload
+            return &simpleCommand{Opcode: 137, Payload: []byte{byte(uint16(velocity) >> 8), byte(velocity), payload[2], payload[3]}}, nil
+        }
+
+        fastest := abs(first)
+        if abs(second) > fastest {
+            fastest = abs(second)
+        }
+        if fastest <= max {
+            return cmd, nil
+        }
+        scale := func(v int16) int16 {
+            return int16(int32(v) * int32(max) / int32(fastest))
+        }
+        return DriveDirect(scale(first), scale(second)), nil
+    }
+}
+
+func abs(v int16) int16 {
+    if v < 0 {
+        return -v
+    }
+    return v
+}
@@ -0,0 +1,125 @@
+package gocreate
+
+import (
+    "context"
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestInterceptors(t *testing.T) {
+    conn, dev := newTestConnection()
+    mirror, mirrorDev := newTestConnection()
+    ctx := context.Background()
+
+    var seen []string
+    conn.AddInterceptor(func(cmd Command) (Command, error) {
+        seen = append(seen, CommandName(cmd))
+        return cmd, nil
+    })
+    conn.AddInterceptor(func(cmd Command) (Command, error) {
+        switch CommandName(cmd) {
+        case "LEDs":
+            return nil, ErrVetoed
+        case "Full":
+            return Safe(), nil
+        case "Demo":
+            return nil, nil
+        }
+        return cmd, nil
+    })
+    removeMirror := conn.AddInterceptor(func(cmd Command) (Command, error) {
+        mirror.Send(ctx, cmd)
+        return cmd, nil
+    })
+
+    assert.Nil(t, conn.Send(ctx, Start()))
+    assert.Nil(t, conn.Send(ctx, Full()))
+    assert.Equal(t, conn.Send(ctx, Leds(true, true, 0, 0)), ErrVetoed)
+    assert.Nil(t, conn.Send(ctx, Demo(DemoCover)))
+    removeMirror()
+    removeMirror()
+    assert.Nil(t, conn.Send(ctx, Start()))
+    assert.Nil(t, conn.Close())
+
+    assert.Equal(t, seen, []string{"Start", "Full", "LEDs", "Demo", "Start"})
+    assert.Equal(t, dev.Written(), []byte{128, 131, 128}, "Expected vetoed and dropped commands not to be written")
+    assert.Nil(t, mirror.Close())
+    assert.Equal(t, mirrorDev.Written(), []byte{128, 131}, "Expected rewritten commands to be mirrored until removed")
+}
+
+func TestInterceptorsBatch(t *testing.T) {
+    conn, dev := newTestConnection()
+    ctx := context.Background()
+    conn.AddInterceptor(func(cmd Command) (Command, error) {
+        switch CommandName(cmd) {
+        case "LEDs":
+            return nil, ErrVetoed
+        case "Safe":
+            return nil, nil
+        case "Play Song":
+            return Sensors(PacketWall), nil
+        }
+        return cmd, nil
+    })
+
+    assert.Equal(t, conn.SendMany(ctx, []Command{Start(), Leds(false, false, 0, 0)}), ErrVetoed)
+    assert.Nil(t, conn.SendMany(ctx, []Command{Start(), Safe(), Full()}))
+    assert.Nil(t, conn.SendMany(ctx, []Command{Safe(), Safe()}))
+    assert.Equal(t, conn.SendMany(ctx, []Command{Start(), PlaySong(0)}), ErrUnbatchable)
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, dev.Written(), []byte{128, 132}, "Expected a vetoed batch to be dropped entirely")
+}
+
+func TestLimitSpeed(t *testing.T) {
+    limit := LimitSpeed(200)
+    check := func(cmd Command, expected Command, msg string) {
+        limited, err := limit(cmd)
+        assert.Nil(t, err)
+        assert.Equal(t, limited.Assemble(), expected.Assemble(), msg)
+    }
+
+    check(Drive(400, 300), Drive(139, 300), "Expected the outer wheel speed to be limited")
+    check(Drive(-400, -300), Drive(-139, -300), "Expected a reverse Drive velocity to be limited")
+    check(Drive(200, 50), Drive(55, 50), "Expected the outer wheel on a tight curve to be limited")
+    check(Drive(-500, -1), Drive(-200, -1), "Expected the velocity of a spin to be limited")
+    check(DriveStraight(-400), DriveStraight(-200), "Expected the radius of DriveStraight to be kept")
+    check(Spin(300, true), Spin(200, true), "Expected the direction of Spin to be kept")
+    check(Drive(100, 300), Drive(100, 300), "Expected a slow Drive to be unchanged")
+    check(DriveStraight(200), DriveStraight(200), "Expected a slow DriveStraight to be unchanged")
+    check(DriveDirect(400, -100), DriveDirect(200, -50), "Expected both wheels to be scaled together")
+    check(DriveDirect(100, -500), DriveDirect(40, -200), "Expected both wheels to be scaled together")
+    check(DriveDirect(200, -200), DriveDirect(200, -200), "Expected a slow Drive Direct to be unchanged")
+
+    cmd := Leds(true, false, 0, 0)
+    limited, err := limit(cmd)
+    assert.Nil(t, err)
+    assert.True(t, limited == cmd, "Expected other commands to be passed through")
+
+    stop, _ := LimitSpeed(-5)(DriveDirect(100, 100))
+    assert.Equal(t, stop.Assemble(), DriveDirect(0, 0).Assemble())
+}
+
+func TestInterceptorsQuery(t *testing.T) {
+    conn, _, err := NewDryRun(WithStartMode(ModePassive))
+    if !assert.Nil(t, err) {
+        return
+    }
+    ctx := context.Background()
+
+    remove := conn.AddInterceptor(func(cmd Command) (Command, error) {
+        return nil, nil
+    })
+    _, err = conn.Query(ctx, PacketOIMode)
+    assert.Equal(t, err, ErrVetoed, "Expected a dropped sensor request to fail")
+    remove()
+
+    conn.AddInterceptor(func(cmd Command) (Command, error) {
+        if CommandName(cmd) == "Sensors" {
+            return Sensors(PacketWall), nil
+        }
+        return cmd, nil
+    })
+    _, err = conn.Query(ctx, PacketOIMode)
+    assert.Equal(t, err, ErrVetoed, "Expected a replaced sensor request to fail")
+    assert.Nil(t, conn.Close())
+}
@@ -0,0 +1,163 @@
+package gocreate
+
+import (
+    "context"
+    "errors"
+)
+
+// wheelBase is the distance between the Create's wheels in mm.
+const wheelBase = 258
+
+var (
+    // ErrSuperseded is returned when a motion command is replaced by a newer one before
+    // it could be written (see Connection.SetCoalescing).
+    ErrSuperseded = errors.New("Motion command superseded by a newer one")
+    // ErrEmergencyStop is returned for motion commands sent while an emergency stop is in
+    // effect (see Connection.EmergencyStop).
+    ErrEmergencyStop = errors.New("Emergency stop in effect")
+)
+
+// isMotion reports whether a command sets the Create's wheel velocities, as generated by
+// Drive, DriveStraight, Spin and DriveDirect.
+func isMotion(cmd Command) bool {
+    s, ok := cmd.(*simpleCommand)
+    return ok && (s.Opcode == 137 || s.Opcode == 145)
+}
+
+// SetCoalescing enables or disables coalescing of motion commands.  When enabled, a
+// motion command (Drive, DriveStraight, Spin or DriveDirect) which is still waiting to be
+// written is replaced by a newer motion command, so that the Create always receives the
+// most recent motion command rather than working through a backlog of stale ones.  The
+// Send call for the replaced command returns ErrSuperseded.  Other commands are never
+// coalesced, and a motion command is not replaced once another command has been sent
+// after it, so the relative order of motion and non-motion commands is preserved.
+func (c *Connection) SetCoalescing(enabled bool) {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    c.coalesce = enabled
+}
+
+// Coalescing reports whether motion commands are being coalesced.
+func (c *Connection) Coalescing() bool {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    return c.coalesce
+}
+
+func (c *Connection) sendCoalesced(req *sendRequest) error {
+    ctx, done := req.ctx, req.done
+
+    c.stateLock.Lock()
+    if !isMotion(req.cmd) {
+        c.motion = nil
+        c.stateLock.Unlock()
+        return c.wait(ctx, req)
+    }
+    if p := c.motion; p != nil {
+        superseded, replaced := p.done, p.replaced
+        p.ctx, p.cmd, p.done, p.queued = ctx, req.cmd, done, req.queued
+        p.replaced = make(chan struct{})
+        c.stateLock.Unlock()
+
+        close(replaced)
+        superseded <- ErrSuperseded
+        return c.await(ctx, done)
+    }
+    req.replaced = make(chan struct{})
+    c.motion = req
+    c.stateLock.Unlock()
+
+    go c.enqueueMotion(req)
+    return c.await(ctx, done)
+}
+
+// enqueueMotion queues a replaceable motion request.  Until it has been queued, it is
+// governed by the context of whichever command currently occupies it, so cancelling a
+// command which has been replaced does not affect its replacement.
+func (c *Connection) enqueueMotion(req *sendRequest) {
+    for {
+        c.stateLock.Lock()
+        ctx, done, replaced := req.ctx, req.done, req.replaced
+        c.stateLock.Unlock()
+
+        err := c.enqueueUntil(ctx, req, replaced)
+        if err == nil {
+            return
+        }
+
+        c.stateLock.Lock()
+        if req.done != done {
+            // The command was replaced, so keep trying with the replacement's context.
+            c.stateLock.Unlock()
+            continue
+        }
+        if c.motion == req {
+            c.motion = nil
+        }
+        c.stateLock.Unlock()
+        done <- err
+        return
+    }
+}
+
+// enqueueUntil is like enqueue, but also gives up when replaced is closed.
+func (c *Connection) enqueueUntil(ctx context.Context, req *sendRequest, replaced chan struct{}) error {
+    c.lock.RLock()
+    defer c.lock.RUnlock()
+
+    if c.closed {
+        return ErrClosed
+    }
+    select {
+    case c.sendQueue <- req:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-replaced:
+        return ErrSuperseded
+    }
+}
+
+// EmergencyStop immediately stops the Create's wheels by writing a zero DriveDirect
+// command, ahead of any commands waiting to be sent.  It only waits for a command which
+// is already being written to finish, so that the two are not interleaved.  If mode is
+// not nil it is written straight after the stop to leave the OI in a safer mode, and must
+// be Start() for Passive mode or Safe() for Safe mode.  Any other command is not written,
+// and ErrInvalidCommand is returned after the stop.
+//
+// Until ClearEmergencyStop is called, motion commands, including any which were already
+// queued, fail with ErrEmergencyStop.  The emergency stop remains in effect even if
+// writing the stop command fails.
+func (c *Connection) EmergencyStop(mode Command) error {
+    c.stateLock.Lock()
+    c.stopped = true
+    c.stateLock.Unlock()
+
+    c.acquireWrite(true)
+    defer c.releaseWrite(true)
+
+    if err := c.writeCommand(DriveDirect(0, 0)); err != nil {
+        return err
+    }
+    if mode == nil {
+        return nil
+    }
+    if s, ok := mode.(*simpleCommand); !ok || (s.Opcode != 128 && s.Opcode != 131) {
+        return ErrInvalidCommand
+    }
+    return c.writeCommand(mode)
+}
+
+// ClearEmergencyStop allows motion commands to be sent again after an emergency stop.
+func (c *Connection) ClearEmergencyStop() {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    c.stopped = false
+}
+
+// Stopped reports whether an emergency stop is in effect.
+func (c *Connection) Stopped() bool {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    return c.stopped
+}
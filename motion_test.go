@@ -0,0 +1,191 @@
+package gocreate
+
+import (
+    "context"
+    "github.com/stretchr/testify/assert"
+    "testing"
+    "time"
+)
+
+// sendAsync sends a command on another goroutine, waits for it to be queued, and
+// returns a channel for the result.
+func sendAsync(conn *Connection, cmd Command, queued int) chan error {
+    result := make(chan error, 1)
+    go func() {
+        result <- conn.Send(context.Background(), cmd)
+    }()
+    for len(conn.sendQueue) < queued {
+        time.Sleep(time.Millisecond)
+    }
+    return result
+}
+
+func TestIsMotion(t *testing.T) {
+    assert.True(t, isMotion(Drive(100, 200)))
+    assert.True(t, isMotion(DriveStraight(100)))
+    assert.True(t, isMotion(Spin(100, false)))
+    assert.True(t, isMotion(DriveDirect(100, 100)))
+    assert.False(t, isMotion(Start()))
+    assert.False(t, isMotion(Leds(true, true, 0, 0)))
+    assert.False(t, isMotion(Sensors(PacketOIMode)))
+}
+
+func TestCoalescing(t *testing.T) {
+    dev := newBlockingTestDevice()
+    conn := NewConnection(dev, 57600)
+    assert.False(t, conn.Coalescing(), "Expected coalescing to be disabled by default")
+    conn.SetCoalescing(true)
+    assert.True(t, conn.Coalescing())
+
+    first := sendAsync(conn, Start(), 0)
+    <-dev.writing
+
+    drive1 := sendAsync(conn, DriveStraight(100), 1)
+    drive2 := sendAsync(conn, DriveStraight(200), 1)
+    assert.Equal(t, <-drive1, ErrSuperseded, "Expected the stale drive command to be replaced")
+
+    safe := sendAsync(conn, Safe(), 2)
+    drive3 := sendAsync(conn, DriveStraight(300), 3)
+    drive4 := sendAsync(conn, DriveDirect(400, 400), 3)
+    assert.Equal(t, <-drive3, ErrSuperseded, "Expected the stale drive command to be replaced")
+
+    close(dev.release)
+    assert.Nil(t, <-first)
+    assert.Nil(t, <-drive2)
+    assert.Nil(t, <-safe)
+    assert.Nil(t, <-drive4)
+    assert.Nil(t, conn.Close())
+
+    expected := []byte{128, 137, 0x00, 0xC8, 0x80, 0x00, 131, 145, 0x01, 0x90, 0x01, 0x90}
+    assert.Equal(t, dev.Written(), expected, "Expected only the newest motion commands to be written, in order")
+}
+
+func TestCoalescingCancelled(t *testing.T) {
+    dev := newBlockingTestDevice()
+    cfg := defaultConfig(57600)
+    cfg.queueSize = 1
+    conn := newConnection("", dev, cfg)
+    conn.SetCoalescing(true)
+
+    first := sendAsync(conn, Start(), 0)
+    <-dev.writing
+    leds := sendAsync(conn, Leds(true, false, 0, 0), 1)
+
+    // The queue is full, so the drive command waits for space.
+    ctx, cancel := context.WithCancel(context.Background())
+    drive1 := make(chan error, 1)
+    go func() {
+        drive1 <- conn.Send(ctx, DriveStraight(100))
+    }()
+    for {
+        conn.stateLock.Lock()
+        pending := conn.motion != nil
+        conn.stateLock.Unlock()
+        if pending {
+            break
+        }
+        time.Sleep(time.Millisecond)
+    }
+    drive2 := sendAsync(conn, DriveStraight(200), 1)
+    assert.Equal(t, <-drive1, ErrSuperseded)
+
+    cancel()
+    time.Sleep(20 * time.Millisecond)
+    close(dev.release)
+    assert.Nil(t, <-first)
+    assert.Nil(t, <-leds)
+    assert.Nil(t, <-drive2, "Expected the replacement to be unaffected by the cancelled command")
+    assert.Nil(t, conn.Close())
+
+    expected := []byte{128, 139, 0x08, 0, 0, 137, 0x00, 0xC8, 0x80, 0x00}
+    assert.Equal(t, dev.Written(), expected)
+}
+
+func TestCoalescingDisabled(t *testing.T) {
+    dev := newBlockingTestDevice()
+    conn := NewConnection(dev, 57600)
+
+    first := sendAsync(conn, Start(), 0)
+    <-dev.writing
+    drive1 := sendAsync(conn, DriveStraight(100), 1)
+    drive2 := sendAsync(conn, DriveStraight(200), 2)
+
+    close(dev.release)
+    assert.Nil(t, <-first)
+    assert.Nil(t, <-drive1)
+    assert.Nil(t, <-drive2)
+    assert.Nil(t, conn.Close())
+
+    expected := []byte{128, 137, 0x00, 0x64, 0x80, 0x00, 137, 0x00, 0xC8, 0x80, 0x00}
+    assert.Equal(t, dev.Written(), expected)
+}
+
+func TestCoalescingClosed(t *testing.T) {
+    conn, _ := newTestConnection()
+    conn.SetCoalescing(true)
+    assert.Nil(t, conn.Close())
+
+    err := conn.Send(context.Background(), DriveStraight(100))
+    assert.Equal(t, err, ErrClosed)
+}
+
+func TestEmergencyStop(t *testing.T) {
+    dev := newBlockingTestDevice()
+    conn := NewConnection(dev, 57600)
+    ctx := context.Background()
+
+    first := sendAsync(conn, Start(), 0)
+    <-dev.writing
+    drive := sendAsync(conn, DriveStraight(100), 1)
+    leds := sendAsync(conn, Leds(true, false, 0, 0), 2)
+
+    stopped := make(chan error, 1)
+    go func() {
+        stopped <- conn.EmergencyStop(Safe())
+    }()
+    for {
+        conn.writeLock.Lock()
+        waiting := conn.urgent > 0
+        conn.writeLock.Unlock()
+        if waiting {
+            break
+        }
+        time.Sleep(time.Millisecond)
+    }
+    assert.True(t, conn.Stopped())
+
+    close(dev.release)
+    assert.Nil(t, <-first)
+    assert.Nil(t, <-stopped)
+    assert.Equal(t, <-drive, ErrEmergencyStop, "Expected queued motion commands to be rejected")
+    assert.Nil(t, <-leds)
+
+    assert.Equal(t, conn.Send(ctx, Spin(100, true)), ErrEmergencyStop, "Expected new motion commands to be rejected")
+    assert.Nil(t, conn.Send(ctx, Start()), "Expected other commands to be sent during an emergency stop")
+
+    conn.ClearEmergencyStop()
+    assert.False(t, conn.Stopped())
+    assert.Nil(t, conn.Send(ctx, DriveStraight(100)))
+    assert.Nil(t, conn.Close())
+
+    expected := []byte{128, 145, 0, 0, 0, 0, 131, 139, 0x08, 0, 0, 128, 137, 0x00, 0x64, 0x80, 0x00}
+    assert.Equal(t, dev.Written(), expected, "Expected the stop to be written ahead of queued commands")
+}
+
+func TestEmergencyStopInvalidMode(t *testing.T) {
+    conn, dev := newTestConnection()
+    assert.Equal(t, conn.EmergencyStop(Drive(500, 0)), ErrInvalidCommand, "Expected a motion command to be refused")
+    assert.Equal(t, conn.EmergencyStop(Full()), ErrInvalidCommand, "Expected Full mode to be refused")
+    assert.True(t, conn.Stopped(), "Expected the emergency stop to remain in effect")
+    assert.Nil(t, conn.Close())
+
+    halt := DriveDirect(0, 0).Assemble()
+    assert.Equal(t, dev.Written(), append(append([]byte(nil), halt...), halt...), "Expected only the stops to be written")
+}
+
+func TestEmergencyStopWithoutMode(t *testing.T) {
+    conn, dev := newTestConnection()
+    assert.Nil(t, conn.EmergencyStop(nil))
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, dev.Written(), []byte{145, 0, 0, 0, 0})
+}
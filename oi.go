@@ -28,6 +28,18 @@ type baudCommand struct {
     Rate    uint
 }
 
+type sensorCommand struct {
+    Opcode   byte
+    Payload  []byte
+    Length   int
+    response chan []byte
+}
+
+// sensorTimeout is the time in ms that the Create is given to begin replying to a sensor
+// request.  Connections add the time needed to transfer the reply at the current baud
+// rate.
+const sensorTimeout = 100
+
 // DemoNumber is a value indicating one of the Create's built in demo actions.
 type DemoNumber byte
 
@@ -88,6 +100,22 @@ func (b *baudCommand) Timeout() int {
     return 0
 }
 
+func (s *sensorCommand) Assemble() []byte {
+    return append([]byte{s.Opcode}, s.Payload...)
+}
+
+func (s *sensorCommand) Channel() chan []byte {
+    return s.response
+}
+
+func (s *sensorCommand) Timeout() int {
+    return sensorTimeout
+}
+
+func (s *sensorCommand) responseLength() int {
+    return s.Length
+}
+
 // Start generates the "Start" command to initialize the OI.
 func Start() Command {
     return &simpleCommand{Opcode: 128}
@@ -248,6 +276,18 @@ func PwmLowSideDrivers(driver0 byte, driver1 byte, driver2 byte) Command {
     return &simpleCommand{Opcode: 144, Payload: payload}
 }
 
+// LowSideDrivers generates the "Low Side Drivers" command to turn each of the Create's
+// three low side drivers fully on or off.  Bit 0 controls driver 0, bit 1 driver 1 and
+// bit 2 driver 2.
+func LowSideDrivers(bits byte) Command {
+    if bits > 0x07 {
+        return nil
+    }
+
+    payload := []byte{bits}
+    return &simpleCommand{Opcode: 138, Payload: payload}
+}
+
 // SendIr generates the "Send IR" command to use the Create's low side driver 1 to send
 // a byte in a format suitable for reception by a Create's IR receiver.  External
 // circuitry must be attached to the driver pin for this to work, as described in the
@@ -285,3 +325,66 @@ func PlaySong(number byte) Command {
     payload := []byte{number}
     return &simpleCommand{Opcode: 141, Payload: payload}
 }
+
+// Sensors generates the "Sensors" command, which requests the value of a single sensor
+// packet or packet group.  The reply is delivered on the command's channel once the
+// command has been sent.
+func Sensors(packet SensorPacket) Command {
+    length := packet.Size()
+    if length == 0 {
+        return nil
+    }
+
+    payload := []byte{byte(packet)}
+    return &sensorCommand{Opcode: 142, Payload: payload, Length: length, response: make(chan []byte, 1)}
+}
+
+// QueryList generates the "Query List" command, which requests the values of several
+// sensor packets at once.  The reply, consisting of the packet values concatenated in
+// the requested order, is delivered on the command's channel once the command has been
+// sent.
+func QueryList(packets ...SensorPacket) Command {
+    if len(packets) < 1 || len(packets) > 255 {
+        return nil
+    }
+
+    length := 0
+    payload := []byte{byte(len(packets))}
+    for _, p := range packets {
+        size := p.Size()
+        if size == 0 {
+            return nil
+        }
+        length += size
+        payload = append(payload, byte(p))
+    }
+    return &sensorCommand{Opcode: 149, Payload: payload, Length: length, response: make(chan []byte, 1)}
+}
+
+// Stream generates the "Stream" command, which starts a stream of sensor data containing
+// the given packets, sent by the Create every 15ms.  Streaming no packets stops the
+// stream.
+func Stream(packets ...SensorPacket) Command {
+    if len(packets) > 255 {
+        return nil
+    }
+
+    payload := []byte{byte(len(packets))}
+    for _, p := range packets {
+        if p.Size() == 0 {
+            return nil
+        }
+        payload = append(payload, byte(p))
+    }
+    return &simpleCommand{Opcode: 148, Payload: payload}
+}
+
+// PauseResumeStream generates the "Pause/Resume Stream" command, which stops or restarts
+// a sensor data stream without clearing its list of packets.
+func PauseResumeStream(resume bool) Command {
+    payload := []byte{0}
+    if resume {
+        payload[0] = 1
+    }
+    return &simpleCommand{Opcode: 150, Payload: payload}
+}
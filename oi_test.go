@@ -166,6 +166,18 @@ func TestDigitalOutputs(t *testing.T) {
     assert.Nil(t, c, "Expected creation of digital output command with excessive value to fail")
 }
 
+func TestLowSideDrivers(t *testing.T) {
+    for i := 0; i < 8; i++ {
+        c := LowSideDrivers(byte(i))
+        if assert.NotNil(t, c) {
+            assert.Equal(t, c.Assemble(), []byte{138, byte(i)}, "Assembled command string for low side driver value 0x%02X is incorrect", i)
+        }
+    }
+
+    c := LowSideDrivers(0x08)
+    assert.Nil(t, c, "Expected creation of low side driver command with excessive value to fail")
+}
+
 type DriverTriplet struct {
     a   byte
     b   byte
@@ -234,3 +246,47 @@ func TestPlaySong(t *testing.T) {
     c = PlaySong(20)
     assert.Nil(t, c, "Expected creation of PlaySong command with excessive number to fail")
 }
+
+func TestSensors(t *testing.T) {
+    c := Sensors(PacketOIMode)
+    if assert.NotNil(t, c) {
+        assert.Equal(t, c.Assemble(), []byte{142, 35}, "Assembled command string for sensor request is incorrect")
+        assert.NotNil(t, c.Channel(), "Expected sensor request to have a response channel")
+        assert.True(t, c.Timeout() > 0, "Expected sensor request to have a response timeout")
+    }
+
+    c = Sensors(SensorPacket(43))
+    assert.Nil(t, c, "Expected creation of Sensors command with unknown packet to fail")
+}
+
+func TestQueryList(t *testing.T) {
+    c := QueryList(PacketBumpsAndWheelDrops, PacketDistance, PacketGroup3)
+    if assert.NotNil(t, c) {
+        assert.Equal(t, c.Assemble(), []byte{149, 3, 7, 19, 3}, "Assembled command string for query list is incorrect")
+        assert.Equal(t, c.(responseSizer).responseLength(), 13)
+    }
+
+    c = QueryList()
+    assert.Nil(t, c, "Expected creation of QueryList command with no packets to fail")
+    c = QueryList(PacketWall, SensorPacket(99))
+    assert.Nil(t, c, "Expected creation of QueryList command with unknown packet to fail")
+}
+
+func TestStream(t *testing.T) {
+    c := Stream(PacketOIMode, PacketDistance)
+    if assert.NotNil(t, c) {
+        assert.Equal(t, c.Assemble(), []byte{148, 2, 35, 19}, "Assembled command string for stream is incorrect")
+    }
+    c = Stream()
+    assert.Equal(t, c.Assemble(), []byte{148, 0}, "Assembled command string for stopping stream is incorrect")
+
+    c = Stream(PacketWall, SensorPacket(99))
+    assert.Nil(t, c, "Expected creation of Stream command with unknown packet to fail")
+}
+
+func TestPauseResumeStream(t *testing.T) {
+    c := PauseResumeStream(false)
+    assert.Equal(t, c.Assemble(), []byte{150, 0}, "Assembled command string for pausing stream is incorrect")
+    c = PauseResumeStream(true)
+    assert.Equal(t, c.Assemble(), []byte{150, 1}, "Assembled command string for resuming stream is incorrect")
+}
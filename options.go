@@ -0,0 +1,225 @@
+package gocreate
+
+import (
+    "context"
+    "errors"
+    "io"
+    "log/slog"
+    "time"
+)
+
+type config struct {
+    baud        uint
+    queueSize   int
+    pacing      *Pacing
+    tracer      Tracer
+    readTimeout time.Duration
+    startMode   Mode
+    watchdog    time.Duration
+    heartbeat   time.Duration
+    transport   io.ReadWriteCloser
+    reconnect   *ReconnectPolicy
+    reopen      func(baud uint) (io.ReadWriteCloser, error)
+    onLink      LinkHandler
+    safeClose   bool
+}
+
+func defaultConfig(baud uint) *config {
+    return &config{baud: baud, queueSize: sendQueueSize}
+}
+
+// Option configures a connection created by Open.
+type Option func(cfg *config)
+
+// WithBaud sets the baud rate the Create is currently using.  If the rate is 0, it is
+// detected by probing each of the OI baud rates (see DetectBaud).  The default is 57600,
+// the Create's default rate.
+func WithBaud(rate uint) Option {
+    return func(cfg *config) {
+        cfg.baud = rate
+    }
+}
+
+// WithQueueSize sets how many commands can be waiting to be written before Send blocks.
+// The default is 16.
+func WithQueueSize(size int) Option {
+    return func(cfg *config) {
+        if size < 0 {
+            size = 0
+        }
+        cfg.queueSize = size
+    }
+}
+
+// WithPacing sets a fixed pacing policy (see Connection.SetPacing).  By default the
+// pacing is chosen from the baud rate.
+func WithPacing(pacing Pacing) Option {
+    return func(cfg *config) {
+        cfg.pacing = &pacing
+    }
+}
+
+// WithTracer installs a tracer for the connection's traffic (see Connection.SetTracer).
+func WithTracer(tracer Tracer) Option {
+    return func(cfg *config) {
+        cfg.tracer = tracer
+    }
+}
+
+// WithLogger logs the connection's traffic to the given logger at debug level (see
+// SlogTracer).
+func WithLogger(logger *slog.Logger) Option {
+    return WithTracer(SlogTracer(logger))
+}
+
+// WithReadTimeout sets how long to wait for the Create to begin replying to a sensor
+// request, instead of the request's own timeout.  The time needed to transfer the reply
+// at the current baud rate is always added.
+func WithReadTimeout(timeout time.Duration) Option {
+    return func(cfg *config) {
+        cfg.readTimeout = timeout
+    }
+}
+
+// WithStartMode starts the OI and switches it to the given mode once the connection is
+// open.  ModeOff, the default, leaves the OI alone.
+func WithStartMode(mode Mode) Option {
+    return func(cfg *config) {
+        cfg.startMode = mode
+    }
+}
+
+// WithWatchdog enables the dead-man watchdog with the given interval (see
+// Connection.StartWatchdog).
+func WithWatchdog(interval time.Duration) Option {
+    return func(cfg *config) {
+        cfg.watchdog = interval
+    }
+}
+
+// WithHeartbeat enables the liveness heartbeat with the given interval (see
+// Connection.StartHeartbeat).
+func WithHeartbeat(interval time.Duration) Option {
+    return func(cfg *config) {
+        cfg.heartbeat = interval
+    }
+}
+
+// WithSafeShutdown makes Close bring the Create to a safe state before closing the
+// transport (see Connection.Shutdown).
+func WithSafeShutdown() Option {
+    return func(cfg *config) {
+        cfg.safeClose = true
+    }
+}
+
+// WithTransport uses the given transport instead of opening the port as a serial
+// device.  The port name is then only used as the connection's Port.  Open takes
+// ownership of the transport: it is closed when the connection is closed, or before
+// Open returns if opening fails for any reason.
+func WithTransport(transport io.ReadWriteCloser) Option {
+    return func(cfg *config) {
+        cfg.transport = transport
+    }
+}
+
+// WithReconnect makes the connection reopen its serial device if reading or writing
+// fails, for example because a USB serial adapter was unplugged, retrying according to
+// the given policy.  Once the device has been reopened, the Create's baud rate and OI
+// mode are restored.  If the port has a stable name in /dev/serial/by-id, that name is
+// used to reopen it, in case the adapter comes back under a different kernel name.
+// While the link is down, commands fail with ErrDisconnected.
+//
+// Reconnection is not possible with WithTransport, since the transport cannot be
+// reopened.
+func WithReconnect(policy ReconnectPolicy) Option {
+    return func(cfg *config) {
+        cfg.reconnect = &policy
+    }
+}
+
+// WithLinkHandler installs a handler for changes in the state of the connection's link
+// to the Create (see Connection.SetLinkHandler).
+func WithLinkHandler(handler LinkHandler) Option {
+    return func(cfg *config) {
+        cfg.onLink = handler
+    }
+}
+
+// Open opens a new connection to a Create on the given serial port, configured by the
+// given options.
+func Open(port string, opts ...Option) (*Connection, error) {
+    cfg := defaultConfig(probeRates[0])
+    for _, opt := range opts {
+        opt(cfg)
+    }
+    if cfg.startMode > ModeFull {
+        if cfg.transport != nil {
+            cfg.transport.Close()
+        }
+        return nil, errors.New("Invalid start mode")
+    }
+
+    detect := cfg.baud == 0
+    if detect {
+        cfg.baud = probeRates[0]
+    }
+
+    transport := cfg.transport
+    if transport == nil {
+        var err error
+        if transport, err = openTransport(port, cfg.baud); err != nil {
+            return nil, err
+        }
+
+        stable := stablePort(port)
+        cfg.reopen = func(baud uint) (io.ReadWriteCloser, error) {
+            return openTransport(stable, baud)
+        }
+    }
+
+    conn := newConnection(port, transport, cfg)
+    if err := conn.setup(cfg, detect); err != nil {
+        // The Create's state is unknown, so close without a safe shutdown.
+        conn.SetSafeShutdown(false)
+        conn.Close()
+        return nil, err
+    }
+    return conn, nil
+}
+
+func (c *Connection) setup(cfg *config, detect bool) error {
+    ctx := context.Background()
+    if detect {
+        if _, err := c.DetectBaud(ctx); err != nil {
+            return err
+        }
+    }
+
+    switch cfg.startMode {
+    case ModePassive:
+        if err := c.Send(ctx, Start()); err != nil {
+            return err
+        }
+    case ModeSafe:
+        if err := c.SendMany(ctx, []Command{Start(), Safe()}); err != nil {
+            return err
+        }
+    case ModeFull:
+        if err := c.SendMany(ctx, []Command{Start(), Full()}); err != nil {
+            return err
+        }
+    }
+
+    if cfg.watchdog != 0 {
+        if err := c.StartWatchdog(cfg.watchdog); err != nil {
+            return err
+        }
+    }
+    if cfg.heartbeat != 0 {
+        if err := c.StartHeartbeat(cfg.heartbeat); err != nil {
+            return err
+        }
+    }
+    return nil
+}
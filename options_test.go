@@ -0,0 +1,97 @@
+package gocreate
+
+import (
+    "bytes"
+    "context"
+    "github.com/stretchr/testify/assert"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestOpen(t *testing.T) {
+    dev := newRobotTestDevice(115200)
+    var lock sync.Mutex
+    traced := 0
+
+    conn, err := Open("robot",
+        WithTransport(dev),
+        WithBaud(115200),
+        WithQueueSize(4),
+        WithPacing(NoPacing),
+        WithStartMode(ModeFull),
+        WithWatchdog(20*time.Millisecond),
+        WithTracer(func(event TraceEvent) {
+            lock.Lock()
+            traced++
+            lock.Unlock()
+        }))
+    if !assert.Nil(t, err) {
+        return
+    }
+    assert.Equal(t, conn.Port(), "robot")
+    assert.Equal(t, conn.CurrentBaud(), uint(115200))
+    assert.Equal(t, cap(conn.sendQueue), 4)
+    assert.Equal(t, conn.CurrentPacing(), NoPacing)
+
+    reply, err := conn.Query(context.Background(), PacketOIMode)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{byte(ModeFull)}, "Expected the OI to be started in Full mode")
+
+    time.Sleep(60 * time.Millisecond)
+    assert.Nil(t, conn.Close())
+
+    expected := bytes.Join([][]byte{{128, 132, 142, 35}, DriveDirect(0, 0).Assemble()}, nil)
+    assert.Equal(t, dev.Written(), expected, "Expected the watchdog to halt the idle Create")
+    lock.Lock()
+    assert.Equal(t, traced, 4)
+    lock.Unlock()
+}
+
+func TestOpenDetectBaud(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    dev.robotRate = 19200
+
+    conn, err := Open("robot", WithTransport(dev), WithBaud(0))
+    if !assert.Nil(t, err) {
+        return
+    }
+    assert.Equal(t, conn.CurrentBaud(), uint(19200))
+    assert.Nil(t, conn.Close())
+
+    dev = newRobotTestDevice(57600)
+    dev.robotRate = 0
+    _, err = Open("robot", WithTransport(dev), WithBaud(0))
+    assert.NotNil(t, err, "Expected opening to fail when the baud rate cannot be detected")
+}
+
+func TestOpenReadTimeout(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    dev.robotRate = 0
+
+    conn, err := Open("robot", WithTransport(dev), WithReadTimeout(150*time.Millisecond))
+    if !assert.Nil(t, err) {
+        return
+    }
+    start := time.Now()
+    _, err = conn.Query(context.Background(), PacketOIMode)
+    assert.Equal(t, err, ErrNoResponse)
+    assert.True(t, time.Since(start) >= 150*time.Millisecond, "Expected the read timeout to be used")
+    assert.Nil(t, conn.Close())
+}
+
+func TestOpenErrors(t *testing.T) {
+    _, err := Open("/dev/gocreate-does-not-exist")
+    assert.NotNil(t, err, "Expected opening a missing serial port to fail")
+    assert.Nil(t, Connect("/dev/gocreate-does-not-exist", 57600))
+
+    dev := newTestDevice()
+    _, err = Open("robot", WithTransport(dev), WithStartMode(Mode(7)))
+    assert.NotNil(t, err, "Expected an invalid start mode to be rejected")
+    assert.Empty(t, dev.Written(), "Expected the transport to be closed")
+
+    dev = newTestDevice()
+    _, err = Open("robot", WithTransport(dev), WithStartMode(ModeSafe), WithSafeShutdown(), WithHeartbeat(-time.Second))
+    assert.Equal(t, err, ErrInvalidInterval)
+    assert.Equal(t, dev.Written(), []byte{128, 131}, "Expected the transport to be closed without a safe shutdown")
+}
@@ -0,0 +1,205 @@
+package gocreate
+
+import (
+    "time"
+)
+
+// byteInterval is the minimum time between the starts of successive bytes received by
+// the Create above its default rate of 57600 baud.  The OI specification requires at
+// least 200 µs between the onset of each character at 115200 baud.
+const byteInterval = 200 * time.Microsecond
+
+// pacedBaud is the highest rate at which the Create receives bytes sent back to back.
+const pacedBaud = 57600
+
+// byteTime returns the time taken to transmit one byte, with its start and stop bits, at
+// the given baud rate.
+func byteTime(baud uint) time.Duration {
+    return 10 * time.Second / time.Duration(baud)
+}
+
+// Pacing controls how data is spaced out when it is written to the Create.
+//
+// ByteDelay is a delay before each byte.  When it is non-zero bytes are written to the
+// transport one at a time.
+//
+// CommandGap is the minimum time between the end of one command and the start of the
+// next.
+type Pacing struct {
+    ByteDelay  time.Duration
+    CommandGap time.Duration
+}
+
+// NoPacing writes data as quickly as the transport will accept it.
+var NoPacing = Pacing{}
+
+// DefaultPacing returns the pacing suited to the Create's receive limits at the given
+// baud rate.  Above 57600 baud, the byte delay makes up the difference between the time
+// each byte takes to transmit and the 200 µs the Create needs between bytes, which is
+// about 113 µs at 115200 baud.  No command gap is needed, since the limit applies to
+// every byte, and at 57600 baud and below no pacing is needed at all.
+func DefaultPacing(baud uint) Pacing {
+    if baud <= pacedBaud {
+        return NoPacing
+    }
+    if delay := byteInterval - byteTime(baud); delay > 0 {
+        return Pacing{ByteDelay: delay}
+    }
+    return NoPacing
+}
+
+// Throughput describes the data written over a connection.
+//
+// Bytes and Commands are the number of bytes and commands written.
+//
+// Busy is the total time spent writing, including any pacing delays.
+type Throughput struct {
+    Bytes    uint64
+    Commands uint64
+    Busy     time.Duration
+}
+
+// BytesPerSecond returns the effective rate at which data was written while the
+// connection was busy, or 0 if nothing has been written.
+func (t Throughput) BytesPerSecond() float64 {
+    if t.Busy <= 0 {
+        return 0
+    }
+    return float64(t.Bytes) / t.Busy.Seconds()
+}
+
+// SetPacing sets a fixed pacing policy for the connection, which is used regardless of
+// the baud rate.  Use NoPacing to disable pacing altogether.
+func (c *Connection) SetPacing(p Pacing) {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    c.pacing = p
+    c.custom = true
+}
+
+// UseDefaultPacing makes the connection choose its pacing from the current baud rate
+// (see DefaultPacing).  This is the initial behaviour of a connection.
+func (c *Connection) UseDefaultPacing() {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    c.custom = false
+}
+
+// CurrentPacing returns the pacing currently in use by the connection.
+func (c *Connection) CurrentPacing() Pacing {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    return c.currentPacing()
+}
+
+func (c *Connection) currentPacing() Pacing {
+    if c.custom {
+        return c.pacing
+    }
+    return DefaultPacing(c.baud)
+}
+
+// Throughput returns the amount of data written over the connection so far and the
+// time spent writing it.
+func (c *Connection) Throughput() Throughput {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    return c.written
+}
+
+// acquireWrite waits for exclusive use of the transport for writing, so that data
+// written from outside the sender goroutine is never interleaved with another command.
+// Urgent writers, such as an emergency stop, go ahead of any waiting normal writers.
+func (c *Connection) acquireWrite(urgent bool) {
+    c.writeLock.Lock()
+    defer c.writeLock.Unlock()
+
+    if urgent {
+        c.urgent++
+    }
+    for c.writing || (!urgent && c.urgent > 0) {
+        c.writeCond.Wait()
+    }
+    c.writing = true
+}
+
+func (c *Connection) releaseWrite(urgent bool) {
+    c.writeLock.Lock()
+    c.writing = false
+    if urgent {
+        c.urgent--
+    }
+    c.writeLock.Unlock()
+    c.writeCond.Broadcast()
+}
+
+// sendCommand writes a single command to the transport.
+func (c *Connection) sendCommand(cmd Command) error {
+    c.acquireWrite(false)
+    defer c.releaseWrite(false)
+    return c.writeCommand(cmd)
+}
+
+// writeCommand writes a command to the transport using the current pacing.  The caller
+// must have acquired the transport for writing.
+func (c *Connection) writeCommand(cmd Command) error {
+    data := cmd.Assemble()
+
+    c.stateLock.Lock()
+    pacing := c.currentPacing()
+    tracer := c.tracer
+    device, down := c.device, c.down
+    c.stateLock.Unlock()
+
+    if down {
+        return ErrDisconnected
+    }
+
+    start := time.Now()
+    if pacing.CommandGap > 0 {
+        if wait := pacing.CommandGap - start.Sub(c.lastWrite); wait > 0 {
+            time.Sleep(wait)
+        }
+    }
+
+    if tracer != nil {
+        tracer(TraceEvent{Time: time.Now(), Direction: Outbound, Data: data, Command: cmd})
+    }
+
+    var err error
+    if pacing.ByteDelay > 0 {
+        for _, b := range data {
+            time.Sleep(pacing.ByteDelay)
+            if _, err = device.Write([]byte{b}); err != nil {
+                break
+            }
+        }
+    } else {
+        _, err = device.Write(data)
+    }
+    c.lastWrite = time.Now()
+    if err != nil {
+        c.linkFailed(device, err)
+    }
+
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    c.written.Busy += c.lastWrite.Sub(start)
+    if err == nil {
+        parts := commandsOf(cmd)
+        c.written.Bytes += uint64(len(data))
+        c.written.Commands += uint64(len(parts))
+        for _, part := range parts {
+            assembled := part.Assemble()
+            c.recordWrite(assembled)
+            if len(assembled) == 0 {
+                continue
+            }
+            if mode, ok := commandedMode(assembled[0]); ok {
+                c.oiMode = mode
+                c.liveness.reset = false
+            }
+        }
+    }
+    return err
+}
@@ -0,0 +1,77 @@
+package gocreate
+
+import (
+    "context"
+    "github.com/stretchr/testify/assert"
+    "testing"
+    "time"
+)
+
+// chunkTestDevice is a testDevice which records the size of each write.
+type chunkTestDevice struct {
+    *testDevice
+    chunks []int
+}
+
+func (d *chunkTestDevice) Write(p []byte) (int, error) {
+    d.lock.Lock()
+    d.chunks = append(d.chunks, len(p))
+    d.lock.Unlock()
+    return d.testDevice.Write(p)
+}
+
+func TestDefaultPacing(t *testing.T) {
+    assert.Equal(t, DefaultPacing(115200), Pacing{ByteDelay: 113195 * time.Nanosecond})
+    assert.Equal(t, DefaultPacing(230400), Pacing{ByteDelay: 156598 * time.Nanosecond})
+    assert.Equal(t, DefaultPacing(57600), NoPacing)
+    assert.Equal(t, DefaultPacing(19200), NoPacing)
+    assert.Equal(t, DefaultPacing(300), NoPacing)
+
+    for _, baud := range []uint{115200, 230400} {
+        pacing := DefaultPacing(baud)
+        assert.Equal(t, pacing.ByteDelay+byteTime(baud), byteInterval, "Expected each byte to take the full interval")
+        assert.Equal(t, pacing.CommandGap, time.Duration(0))
+    }
+}
+
+func TestPacingPerByte(t *testing.T) {
+    dev := &chunkTestDevice{testDevice: newTestDevice()}
+    conn := NewConnection(dev, 115200)
+    assert.Equal(t, conn.CurrentPacing(), DefaultPacing(115200))
+
+    assert.Nil(t, conn.Send(context.Background(), Drive(100, 0)))
+    conn.SetPacing(NoPacing)
+    assert.Nil(t, conn.Send(context.Background(), Drive(100, 0)))
+    assert.Nil(t, conn.Close())
+
+    assert.Equal(t, dev.chunks, []int{1, 1, 1, 1, 1, 5}, "Expected bytes to be written individually only with a byte delay")
+}
+
+func TestPacingCommandGap(t *testing.T) {
+    conn, _ := newTestConnection()
+    conn.SetPacing(Pacing{CommandGap: 20 * time.Millisecond})
+
+    start := time.Now()
+    for i := 0; i < 3; i++ {
+        assert.Nil(t, conn.Send(context.Background(), Start()))
+    }
+    assert.True(t, time.Since(start) >= 40*time.Millisecond, "Expected commands to be spaced by the command gap")
+
+    conn.UseDefaultPacing()
+    assert.Equal(t, conn.CurrentPacing(), NoPacing)
+    assert.Nil(t, conn.Close())
+}
+
+func TestThroughput(t *testing.T) {
+    conn, _ := newTestConnection()
+    assert.Equal(t, conn.Throughput().BytesPerSecond(), 0.0)
+
+    assert.Nil(t, conn.Send(context.Background(), Start()))
+    assert.Nil(t, conn.Send(context.Background(), DriveDirect(100, 100)))
+    assert.Nil(t, conn.Close())
+
+    throughput := conn.Throughput()
+    assert.Equal(t, throughput.Bytes, uint64(6))
+    assert.Equal(t, throughput.Commands, uint64(2))
+    assert.True(t, throughput.BytesPerSecond() > 0)
+}
@@ -0,0 +1,95 @@
+package gocreate
+
+import (
+    "fmt"
+)
+
+// commandLengths is the total length, including the opcode, of each OI command with a
+// fixed length.
+var commandLengths = map[byte]int{
+    128: 1, 129: 2, 130: 1, 131: 1, 132: 1, 134: 1, 135: 1, 136: 2, 137: 5, 138: 2, 139: 4,
+    141: 2, 142: 2, 143: 1, 144: 4, 145: 5, 147: 2, 150: 2, 151: 2, 153: 1, 154: 1, 155: 2,
+    156: 3, 157: 3, 158: 2,
+}
+
+// baudCodes lists the OI baud rates in the order of their Baud command codes.
+var baudCodes = []uint{300, 600, 1200, 2400, 4800, 9600, 14400, 19200, 28800, 38400, 57600, 115200}
+
+// commandLength returns the total length of the command at the start of data, or 0 if
+// more data is needed to tell.  It returns false if the opcode is unknown.
+func commandLength(data []byte) (int, bool) {
+    if len(data) == 0 {
+        return 0, true
+    }
+    if length, ok := commandLengths[data[0]]; ok {
+        return length, true
+    }
+
+    switch data[0] {
+    case 140:
+        // Song: number, note count, then a tone and duration for each note.
+        if len(data) < 3 {
+            return 0, true
+        }
+        return 3 + 2*int(data[2]), true
+    case 148, 149, 152:
+        // Stream, Query List and Script: a count followed by that many bytes.
+        if len(data) < 2 {
+            return 0, true
+        }
+        return 2 + int(data[1]), true
+    }
+    return 0, false
+}
+
+// decodeCommand converts a single complete command back into a Command value.  Baud
+// commands and sensor requests are decoded into the same kinds of command as their
+// generators produce, and others into equivalent generic commands.
+func decodeCommand(data []byte) (Command, error) {
+    opcode, payload := data[0], append([]byte(nil), data[1:]...)
+    switch opcode {
+    case 129:
+        if int(payload[0]) < len(baudCodes) {
+            return Baud(baudCodes[payload[0]]), nil
+        }
+    case 142:
+        if cmd := Sensors(SensorPacket(payload[0])); cmd != nil {
+            return cmd, nil
+        }
+    case 149:
+        packets := make([]SensorPacket, len(payload)-1)
+        for i, p := range payload[1:] {
+            packets[i] = SensorPacket(p)
+        }
+        if cmd := QueryList(packets...); cmd != nil {
+            return cmd, nil
+        }
+    default:
+        return &simpleCommand{Opcode: opcode, Payload: payload}, nil
+    }
+    return nil, fmt.Errorf("Invalid %s command % X", OpcodeName(opcode), data)
+}
+
+// ParseCommands decodes an OI byte stream, such as the data written by a Connection, back
+// into commands.  If the stream contains an unknown opcode, an invalid command or a
+// truncated command, the commands decoded before it are returned with an error.
+func ParseCommands(data []byte) ([]Command, error) {
+    var cmds []Command
+    for offset := 0; offset < len(data); {
+        length, ok := commandLength(data[offset:])
+        if !ok {
+            return cmds, fmt.Errorf("Unknown opcode %d at offset %d", data[offset], offset)
+        }
+        if length == 0 || offset+length > len(data) {
+            return cmds, fmt.Errorf("Truncated %s command at offset %d", OpcodeName(data[offset]), offset)
+        }
+
+        cmd, err := decodeCommand(data[offset : offset+length])
+        if err != nil {
+            return cmds, fmt.Errorf("%s at offset %d", err.Error(), offset)
+        }
+        cmds = append(cmds, cmd)
+        offset += length
+    }
+    return cmds, nil
+}
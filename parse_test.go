@@ -0,0 +1,64 @@
+package gocreate
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestParseCommands(t *testing.T) {
+    generated := []Command{
+        Start(),
+        Baud(115200),
+        Full(),
+        Demo(DemoCover),
+        DriveDirect(-100, 250),
+        Leds(true, false, 0, 255),
+        Song(3, []Note{{Tone: 60, Duration: 16}, {Tone: 62, Duration: 16}}),
+        PlaySong(3),
+        Sensors(PacketOIMode),
+        QueryList(PacketWall, PacketDistance),
+        PauseResumeStream(false),
+        &simpleCommand{Opcode: 152, Payload: []byte{3, 137, 0, 100}},
+    }
+    var data []byte
+    for _, cmd := range generated {
+        data = append(data, cmd.Assemble()...)
+    }
+
+    cmds, err := ParseCommands(data)
+    assert.Nil(t, err)
+    if !assert.Len(t, cmds, len(generated)) {
+        return
+    }
+    for i, cmd := range cmds {
+        assert.Equal(t, cmd.Assemble(), generated[i].Assemble(), "Command %d decoded incorrectly", i)
+    }
+
+    _, ok := cmds[1].(*baudCommand)
+    assert.True(t, ok, "Expected a Baud command to be decoded")
+    assert.Equal(t, cmds[1].(*baudCommand).Rate, uint(115200))
+    assert.NotNil(t, cmds[8].Channel(), "Expected a sensor request to be decoded")
+    assert.Equal(t, cmds[9].(responseSizer).responseLength(), 3)
+}
+
+func TestParseCommandsInvalid(t *testing.T) {
+    cmds, err := ParseCommands([]byte{128, 132, 200, 128})
+    assert.Len(t, cmds, 2)
+    assert.EqualError(t, err, "Unknown opcode 200 at offset 2")
+
+    cmds, err = ParseCommands([]byte{128, 145, 0, 100})
+    assert.Len(t, cmds, 1)
+    assert.EqualError(t, err, "Truncated Drive Direct command at offset 1")
+
+    cmds, err = ParseCommands([]byte{128, 140, 0})
+    assert.Len(t, cmds, 1)
+    assert.EqualError(t, err, "Truncated Song command at offset 1")
+
+    cmds, err = ParseCommands([]byte{129, 12})
+    assert.Empty(t, cmds)
+    assert.EqualError(t, err, "Invalid Baud command 81 0C at offset 0")
+
+    cmds, err = ParseCommands(nil)
+    assert.Empty(t, cmds)
+    assert.Nil(t, err)
+}
@@ -0,0 +1,266 @@
+package gocreate
+
+import (
+    "context"
+    "errors"
+    "io"
+    "time"
+)
+
+// ErrDisconnected is returned when writing to a connection whose transport has failed
+// and has not been reconnected.
+var ErrDisconnected = errors.New("Connection to Create lost")
+
+// ReconnectPolicy controls how a connection reconnects after its serial device fails,
+// for example because a USB serial adapter was unplugged.
+//
+// The first attempt is made after MinDelay, and the delay doubles after each failed
+// attempt up to MaxDelay.  Attempts limits the number of attempts, and 0 retries
+// forever.
+type ReconnectPolicy struct {
+    MinDelay time.Duration
+    MaxDelay time.Duration
+    Attempts int
+}
+
+// DefaultReconnect is a reconnection policy which retries forever, starting after 100ms
+// and backing off to once every 5 seconds.
+var DefaultReconnect = ReconnectPolicy{MinDelay: 100 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+// LinkState describes the state of a connection's link to the Create.
+type LinkState int
+
+const (
+    // LinkUp indicates that the link has been re-established.
+    LinkUp LinkState = iota
+    // LinkDown indicates that the link has failed, and reconnection has begun.
+    LinkDown
+    // LinkFailed indicates that reconnection has been abandoned.
+    LinkFailed
+)
+
+func (s LinkState) String() string {
+    switch s {
+    case LinkUp:
+        return "up"
+    case LinkDown:
+        return "down"
+    }
+    return "failed"
+}
+
+// LinkEvent describes a change in the state of a connection's link to the Create.
+//
+// Attempt is the number of reconnection attempts made, and is 0 for LinkDown events.
+//
+// Err is the error which caused the link to go down, or the error from the final
+// reconnection attempt for LinkFailed events.
+type LinkEvent struct {
+    Time    time.Time
+    State   LinkState
+    Attempt int
+    Err     error
+}
+
+// LinkHandler is a function which is called when a connection's link goes down, comes
+// back up, or reconnection is abandoned.  It is called synchronously from the
+// connection's goroutines, so it should return quickly.
+type LinkHandler func(event LinkEvent)
+
+// reconnector holds the state of a connection which reconnects to its serial device.
+type reconnector struct {
+    policy ReconnectPolicy
+    reopen func(baud uint) (io.ReadWriteCloser, error)
+    active bool
+}
+
+// SetLinkHandler installs a handler which is called when the connection's link to the
+// Create changes state.  Passing nil removes the handler.
+func (c *Connection) SetLinkHandler(handler LinkHandler) {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    c.onLink = handler
+}
+
+// Connected reports whether the connection's link to the Create is up.  It is false
+// while reconnecting after a failure, and true again once the link has been restored.
+func (c *Connection) Connected() bool {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    return !c.down
+}
+
+func (c *Connection) notify(event LinkEvent) {
+    c.stateLock.Lock()
+    handler := c.onLink
+    c.stateLock.Unlock()
+
+    if handler != nil {
+        event.Time = time.Now()
+        handler(event)
+    }
+}
+
+// transport returns the connection's current transport, and whether it has failed.
+func (c *Connection) transport() (io.ReadWriteCloser, bool) {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    return c.device, c.down
+}
+
+// linkFailed is called when reading from or writing to a transport fails.  If the
+// connection reconnects and the transport is still in use, reconnection begins.
+func (c *Connection) linkFailed(device io.ReadWriteCloser, err error) {
+    if c.link == nil || c.isClosed() {
+        return
+    }
+
+    c.stateLock.Lock()
+    if c.device != device || c.down || c.link.active {
+        c.stateLock.Unlock()
+        return
+    }
+    c.down = true
+    c.link.active = true
+    rate := c.baud
+    c.stateLock.Unlock()
+
+    device.Close()
+    c.notify(LinkEvent{State: LinkDown, Err: err})
+    go c.reconnect(rate)
+}
+
+// awaitLink waits for a failed transport to be replaced, and returns the replacement.
+// It returns nil if the connection does not reconnect, or is closed first.
+func (c *Connection) awaitLink(device io.ReadWriteCloser, err error) io.ReadWriteCloser {
+    c.linkFailed(device, err)
+    if c.link == nil {
+        return nil
+    }
+
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    for c.device == device {
+        select {
+        case <-c.finished:
+            return nil
+        default:
+        }
+        c.linkCond.Wait()
+    }
+    return c.device
+}
+
+func (c *Connection) isClosed() bool {
+    c.lock.RLock()
+    defer c.lock.RUnlock()
+    return c.closed
+}
+
+// reconnect repeatedly tries to reopen the serial device and restore the Create's baud
+// rate and OI mode, backing off according to the reconnection policy.
+func (c *Connection) reconnect(rate uint) {
+    policy := c.link.policy
+    delay := policy.MinDelay
+    var err error
+    attempt := 0
+    for policy.Attempts == 0 || attempt < policy.Attempts {
+        timer := time.NewTimer(delay)
+        select {
+        case <-timer.C:
+        case <-c.finished:
+            timer.Stop()
+            return
+        }
+        if delay *= 2; delay > policy.MaxDelay {
+            delay = policy.MaxDelay
+        }
+
+        attempt++
+        if err = c.relink(rate); err == nil {
+            c.stateLock.Lock()
+            c.link.active = false
+            c.stateLock.Unlock()
+            c.notify(LinkEvent{State: LinkUp, Attempt: attempt})
+            return
+        }
+        if err == ErrClosed {
+            return
+        }
+    }
+    c.notify(LinkEvent{State: LinkFailed, Attempt: attempt, Err: err})
+}
+
+// relink makes a single attempt at reopening the serial device.  The new transport is
+// installed by the sender goroutine, in order with queued commands.
+func (c *Connection) relink(rate uint) error {
+    device, err := c.link.reopen(rate)
+    if err != nil {
+        return err
+    }
+
+    err = c.do(context.Background(), func() error {
+        return c.restoreLink(device, rate)
+    })
+    if err == ErrClosed {
+        device.Close()
+    }
+    return err
+}
+
+// restoreLink installs a new transport and brings the Create back to the baud rate and
+// OI mode it was using.  If this fails the transport is closed, and the link is down
+// again.
+func (c *Connection) restoreLink(device io.ReadWriteCloser, rate uint) error {
+    c.stateLock.Lock()
+    c.device = device
+    c.down = false
+    mode := c.oiMode
+    c.linkCond.Broadcast()
+    c.stateLock.Unlock()
+
+    err := c.resume(rate, mode)
+    if err != nil {
+        c.stateLock.Lock()
+        c.down = true
+        c.stateLock.Unlock()
+        device.Close()
+    }
+    return err
+}
+
+// resume restores the baud rate and OI mode.  The Create may have been reset while it
+// was disconnected, so its baud rate is detected first, which also starts the OI.
+func (c *Connection) resume(rate uint, mode Mode) error {
+    detected, err := c.detect(context.Background())
+    if err != nil {
+        return err
+    }
+    if detected != rate {
+        if err := c.changeBaud(Baud(rate).(*baudCommand)); err != nil {
+            return err
+        }
+    }
+
+    switch mode {
+    case ModeSafe:
+        return c.sendCommand(Safe())
+    case ModeFull:
+        return c.sendCommand(Full())
+    }
+    return nil
+}
+
+// commandedMode returns the OI mode that a command with the given opcode switches the
+// Create to, if any.
+func commandedMode(opcode byte) (Mode, bool) {
+    switch opcode {
+    case 128, 136:
+        return ModePassive, true
+    case 131:
+        return ModeSafe, true
+    case 132:
+        return ModeFull, true
+    }
+    return ModeOff, false
+}
@@ -0,0 +1,196 @@
+package gocreate
+
+import (
+    "context"
+    "errors"
+    "github.com/stretchr/testify/assert"
+    "io"
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+)
+
+// unpluggableTestDevice is a robotTestDevice which can be unplugged, after which reads
+// and writes fail.
+type unpluggableTestDevice struct {
+    *robotTestDevice
+    gone bool
+}
+
+func (d *unpluggableTestDevice) unplug() {
+    d.lock.Lock()
+    d.gone = true
+    d.lock.Unlock()
+    d.cond.Broadcast()
+}
+
+func (d *unpluggableTestDevice) Read(p []byte) (int, error) {
+    d.lock.Lock()
+    for len(d.replies) == 0 && !d.isClosed && !d.gone {
+        d.cond.Wait()
+    }
+    gone := d.gone
+    d.lock.Unlock()
+
+    if gone {
+        return 0, errors.New("device unplugged")
+    }
+    return d.robotTestDevice.Read(p)
+}
+
+func (d *unpluggableTestDevice) Write(p []byte) (int, error) {
+    d.lock.Lock()
+    gone := d.gone
+    d.lock.Unlock()
+
+    if gone {
+        return 0, errors.New("device unplugged")
+    }
+    return d.robotTestDevice.Write(p)
+}
+
+// openTestTransports makes Open use the given transports in turn, failing when a
+// transport is nil or they have all been used.
+func openTestTransports(transports ...io.ReadWriteCloser) func() {
+    var lock sync.Mutex
+    open := openTransport
+    openTransport = func(port string, baud uint) (io.ReadWriteCloser, error) {
+        lock.Lock()
+        defer lock.Unlock()
+
+        if len(transports) == 0 || transports[0] == nil {
+            if len(transports) > 0 {
+                transports = transports[1:]
+            }
+            return nil, errors.New("No such device")
+        }
+        transport := transports[0]
+        transports = transports[1:]
+        return transport, nil
+    }
+    return func() { openTransport = open }
+}
+
+func collectLinkEvents() (LinkHandler, chan LinkEvent) {
+    events := make(chan LinkEvent, 16)
+    return func(event LinkEvent) { events <- event }, events
+}
+
+func nextLinkEvent(t *testing.T, events chan LinkEvent) LinkEvent {
+    select {
+    case event := <-events:
+        return event
+    case <-time.After(time.Second):
+        t.Fatal("Timed out waiting for a link event")
+    }
+    return LinkEvent{}
+}
+
+func TestReconnect(t *testing.T) {
+    first := &unpluggableTestDevice{robotTestDevice: newRobotTestDevice(115200)}
+    second := newRobotTestDevice(115200)
+    second.robotRate = 57600
+    defer openTestTransports(first, nil, second)()
+
+    handler, events := collectLinkEvents()
+    conn, err := Open("robot",
+        WithBaud(115200),
+        WithPacing(NoPacing),
+        WithStartMode(ModeFull),
+        WithReconnect(ReconnectPolicy{MinDelay: 20 * time.Millisecond, MaxDelay: 40 * time.Millisecond}),
+        WithLinkHandler(handler))
+    if !assert.Nil(t, err) {
+        return
+    }
+    assert.True(t, conn.Connected())
+
+    first.unplug()
+    event := nextLinkEvent(t, events)
+    assert.Equal(t, event.State, LinkDown)
+    assert.NotNil(t, event.Err)
+    assert.False(t, conn.Connected())
+    assert.Equal(t, conn.Send(context.Background(), DriveDirect(100, 100)), ErrDisconnected)
+
+    event = nextLinkEvent(t, events)
+    assert.Equal(t, event.State, LinkUp)
+    assert.Equal(t, event.Attempt, 2, "Expected the first attempt to fail to reopen the port")
+    assert.True(t, conn.Connected())
+    assert.Equal(t, conn.CurrentBaud(), uint(115200))
+
+    reply, err := conn.Query(context.Background(), PacketOIMode)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{byte(ModeFull)}, "Expected the OI mode to be restored")
+
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, second.robotRate, uint(115200), "Expected the baud rate to be restored")
+    assert.Equal(t, first.isClosed, true, "Expected the failed device to be closed")
+}
+
+func TestReconnectGiveUp(t *testing.T) {
+    first := &unpluggableTestDevice{robotTestDevice: newRobotTestDevice(57600)}
+    defer openTestTransports(first)()
+
+    handler, events := collectLinkEvents()
+    conn, err := Open("robot",
+        WithReconnect(ReconnectPolicy{MinDelay: time.Millisecond, MaxDelay: time.Millisecond, Attempts: 3}),
+        WithLinkHandler(handler))
+    if !assert.Nil(t, err) {
+        return
+    }
+
+    first.unplug()
+    assert.Equal(t, nextLinkEvent(t, events).State, LinkDown)
+    event := nextLinkEvent(t, events)
+    assert.Equal(t, event.State, LinkFailed)
+    assert.Equal(t, event.Attempt, 3)
+    assert.NotNil(t, event.Err)
+
+    assert.False(t, conn.Connected())
+    assert.Equal(t, conn.Send(context.Background(), Start()), ErrDisconnected)
+    assert.Nil(t, conn.Close())
+}
+
+func TestReconnectDisabled(t *testing.T) {
+    dev := &unpluggableTestDevice{robotTestDevice: newRobotTestDevice(57600)}
+    conn := NewConnection(dev, 57600)
+    handler, events := collectLinkEvents()
+    conn.SetLinkHandler(handler)
+
+    dev.unplug()
+    assert.NotNil(t, conn.Send(context.Background(), Start()))
+    assert.True(t, conn.Connected(), "Expected a connection without reconnection to ignore failures")
+    assert.Nil(t, conn.Close())
+    assert.Len(t, events, 0)
+}
+
+func TestStableName(t *testing.T) {
+    root := t.TempDir()
+    assert.Nil(t, os.MkdirAll(filepath.Join(root, "serial", "by-id"), 0755))
+    for _, name := range []string{"ttyUSB0", "ttyUSB1"} {
+        assert.Nil(t, os.WriteFile(filepath.Join(root, name), nil, 0644))
+    }
+    byID := filepath.Join(root, "serial", "by-id", "usb-FTDI_FT231X_USB_UART_DN0001-if00-port0")
+    assert.Nil(t, os.Symlink(filepath.Join(root, "ttyUSB0"), byID))
+
+    assert.Equal(t, stableName(root, filepath.Join(root, "ttyUSB0")), byID)
+    assert.Equal(t, stableName(root, byID), byID)
+    assert.Equal(t, stableName(root, filepath.Join(root, "ttyUSB1")), filepath.Join(root, "ttyUSB1"))
+    assert.Equal(t, stableName(root, filepath.Join(root, "ttyUSB9")), filepath.Join(root, "ttyUSB9"))
+}
+
+func TestCommandedMode(t *testing.T) {
+    conn, _ := newTestConnection()
+    ctx := context.Background()
+
+    assert.Nil(t, conn.Send(ctx, Start()))
+    assert.Equal(t, conn.oiMode, ModePassive)
+    assert.Nil(t, conn.Send(ctx, Safe()))
+    assert.Equal(t, conn.oiMode, ModeSafe)
+    assert.Nil(t, conn.Send(ctx, Leds(true, true, 0, 255)))
+    assert.Equal(t, conn.oiMode, ModeSafe)
+    assert.Nil(t, conn.EmergencyStop(Start()))
+    assert.Equal(t, conn.oiMode, ModePassive)
+    assert.Nil(t, conn.Close())
+}
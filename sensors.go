@@ -0,0 +1,156 @@
+package gocreate
+
+// SensorPacket identifies one of the Create's sensor packets, or a group of packets.
+type SensorPacket byte
+
+const (
+    // PacketGroup0 is the group of packets 7 to 26.
+    PacketGroup0 SensorPacket = iota
+    // PacketGroup1 is the group of packets 7 to 16.
+    PacketGroup1
+    // PacketGroup2 is the group of packets 17 to 20.
+    PacketGroup2
+    // PacketGroup3 is the group of packets 21 to 26.
+    PacketGroup3
+    // PacketGroup4 is the group of packets 27 to 34.
+    PacketGroup4
+    // PacketGroup5 is the group of packets 35 to 42.
+    PacketGroup5
+    // PacketGroup6 is the group of all packets, 7 to 42.
+    PacketGroup6
+    // PacketBumpsAndWheelDrops is the bump and wheel drop sensor state.
+    PacketBumpsAndWheelDrops
+    // PacketWall is the wall sensor state.
+    PacketWall
+    // PacketCliffLeft is the left cliff sensor state.
+    PacketCliffLeft
+    // PacketCliffFrontLeft is the front left cliff sensor state.
+    PacketCliffFrontLeft
+    // PacketCliffFrontRight is the front right cliff sensor state.
+    PacketCliffFrontRight
+    // PacketCliffRight is the right cliff sensor state.
+    PacketCliffRight
+    // PacketVirtualWall is the virtual wall detector state.
+    PacketVirtualWall
+    // PacketOvercurrents is the low side driver and wheel overcurrent state.
+    PacketOvercurrents
+    // PacketUnused1 is an unused packet which always reads as 0.
+    PacketUnused1
+    // PacketUnused2 is an unused packet which always reads as 0.
+    PacketUnused2
+    // PacketIrByte is the byte most recently received by the omnidirectional IR receiver.
+    PacketIrByte
+    // PacketButtons is the state of the Play and Advance buttons.
+    PacketButtons
+    // PacketDistance is the distance travelled in mm since it was last requested.
+    PacketDistance
+    // PacketAngle is the angle turned in degrees since it was last requested.
+    PacketAngle
+    // PacketChargingState is the battery charging state.
+    PacketChargingState
+    // PacketVoltage is the battery voltage in mV.
+    PacketVoltage
+    // PacketCurrent is the battery current in mA.
+    PacketCurrent
+    // PacketBatteryTemperature is the battery temperature in degrees Celsius.
+    PacketBatteryTemperature
+    // PacketBatteryCharge is the current battery charge in mAh.
+    PacketBatteryCharge
+    // PacketBatteryCapacity is the estimated battery capacity in mAh.
+    PacketBatteryCapacity
+    // PacketWallSignal is the strength of the wall sensor signal.
+    PacketWallSignal
+    // PacketCliffLeftSignal is the strength of the left cliff sensor signal.
+    PacketCliffLeftSignal
+    // PacketCliffFrontLeftSignal is the strength of the front left cliff sensor signal.
+    PacketCliffFrontLeftSignal
+    // PacketCliffFrontRightSignal is the strength of the front right cliff sensor signal.
+    PacketCliffFrontRightSignal
+    // PacketCliffRightSignal is the strength of the right cliff sensor signal.
+    PacketCliffRightSignal
+    // PacketCargoBayDigitalInputs is the state of the cargo bay digital inputs.
+    PacketCargoBayDigitalInputs
+    // PacketCargoBayAnalogSignal is the value of the cargo bay analog input.
+    PacketCargoBayAnalogSignal
+    // PacketChargingSources is the set of available charging sources.
+    PacketChargingSources
+    // PacketOIMode is the current OI mode (see Mode).
+    PacketOIMode
+    // PacketSongNumber is the currently selected song.
+    PacketSongNumber
+    // PacketSongPlaying is whether a song is currently playing.
+    PacketSongPlaying
+    // PacketStreamPackets is the number of packets in the current sensor stream.
+    PacketStreamPackets
+    // PacketRequestedVelocity is the most recently requested drive velocity.
+    PacketRequestedVelocity
+    // PacketRequestedRadius is the most recently requested drive radius.
+    PacketRequestedRadius
+    // PacketRequestedRightVelocity is the most recently requested right wheel velocity.
+    PacketRequestedRightVelocity
+    // PacketRequestedLeftVelocity is the most recently requested left wheel velocity.
+    PacketRequestedLeftVelocity
+)
+
+// packetGroups lists the first and last packets in each packet group.
+var packetGroups = map[SensorPacket][2]SensorPacket{
+    PacketGroup0: {PacketBumpsAndWheelDrops, PacketBatteryCapacity},
+    PacketGroup1: {PacketBumpsAndWheelDrops, PacketUnused2},
+    PacketGroup2: {PacketIrByte, PacketAngle},
+    PacketGroup3: {PacketChargingState, PacketBatteryCapacity},
+    PacketGroup4: {PacketWallSignal, PacketChargingSources},
+    PacketGroup5: {PacketOIMode, PacketRequestedLeftVelocity},
+    PacketGroup6: {PacketBumpsAndWheelDrops, PacketRequestedLeftVelocity},
+}
+
+// twoBytePackets is the set of packets whose values are two bytes long.
+var twoBytePackets = map[SensorPacket]bool{
+    PacketDistance:               true,
+    PacketAngle:                  true,
+    PacketVoltage:                true,
+    PacketCurrent:                true,
+    PacketBatteryCharge:          true,
+    PacketBatteryCapacity:        true,
+    PacketWallSignal:             true,
+    PacketCliffLeftSignal:        true,
+    PacketCliffFrontLeftSignal:   true,
+    PacketCliffFrontRightSignal:  true,
+    PacketCliffRightSignal:       true,
+    PacketCargoBayAnalogSignal:   true,
+    PacketRequestedVelocity:      true,
+    PacketRequestedRadius:        true,
+    PacketRequestedRightVelocity: true,
+    PacketRequestedLeftVelocity:  true,
+}
+
+// Size returns the number of data bytes in the packet, or 0 if the packet is unknown.
+func (p SensorPacket) Size() int {
+    if group, ok := packetGroups[p]; ok {
+        size := 0
+        for q := group[0]; q <= group[1]; q++ {
+            size += q.Size()
+        }
+        return size
+    }
+    if p < PacketBumpsAndWheelDrops || p > PacketRequestedLeftVelocity {
+        return 0
+    }
+    if twoBytePackets[p] {
+        return 2
+    }
+    return 1
+}
+
+// Mode is one of the OI operating modes, as reported by the PacketOIMode sensor packet.
+type Mode byte
+
+const (
+    // ModeOff indicates that the OI has not been started.
+    ModeOff Mode = iota
+    // ModePassive indicates that the OI is in Passive mode.
+    ModePassive
+    // ModeSafe indicates that the OI is in Safe mode.
+    ModeSafe
+    // ModeFull indicates that the OI is in Full mode.
+    ModeFull
+)
@@ -0,0 +1,27 @@
+package gocreate
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestSensorPacketSize(t *testing.T) {
+    groups := map[SensorPacket]int{
+        PacketGroup0: 26,
+        PacketGroup1: 10,
+        PacketGroup2: 6,
+        PacketGroup3: 10,
+        PacketGroup4: 14,
+        PacketGroup5: 12,
+        PacketGroup6: 52,
+    }
+    for p, size := range groups {
+        assert.Equal(t, p.Size(), size, "Size of packet group %d is incorrect", p)
+    }
+
+    assert.Equal(t, PacketBumpsAndWheelDrops.Size(), 1)
+    assert.Equal(t, PacketOIMode.Size(), 1)
+    assert.Equal(t, PacketDistance.Size(), 2)
+    assert.Equal(t, PacketRequestedLeftVelocity.Size(), 2)
+    assert.Equal(t, SensorPacket(43).Size(), 0, "Expected unknown packet to have no size")
+}
@@ -0,0 +1,91 @@
+package gocreate
+
+import (
+    "errors"
+    "github.com/awm/goserial"
+    "io"
+    "sync"
+)
+
+// serialPort is a transport for a local serial device which supports changing its baud
+// rate by re-opening the device.
+type serialPort struct {
+    name string
+    lock sync.Mutex
+    port io.ReadWriteCloser
+}
+
+func openSerialPort(name string, baud uint) (*serialPort, error) {
+    s := &serialPort{name: name}
+    if err := s.open(baud); err != nil {
+        return nil, err
+    }
+    return s, nil
+}
+
+func (s *serialPort) open(baud uint) error {
+    config := &serial.Config{Name: s.name, Baud: int(baud)}
+    port, err := serial.OpenPort(config)
+    if err != nil {
+        return err
+    }
+    s.port = port
+    return nil
+}
+
+func (s *serialPort) current() io.ReadWriteCloser {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    return s.port
+}
+
+// Read reads from the serial device.  If the device is re-opened during a read because
+// of a baud rate change, the read continues on the new device.
+func (s *serialPort) Read(p []byte) (int, error) {
+    for {
+        port := s.current()
+        if port == nil {
+            return 0, errors.New("Serial port is closed")
+        }
+
+        n, err := port.Read(p)
+        if err != nil && n == 0 {
+            if next := s.current(); next != nil && next != port {
+                continue
+            }
+        }
+        return n, err
+    }
+}
+
+func (s *serialPort) Write(p []byte) (int, error) {
+    port := s.current()
+    if port == nil {
+        return 0, errors.New("Serial port is closed")
+    }
+    return port.Write(p)
+}
+
+func (s *serialPort) Close() error {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    if s.port == nil {
+        return nil
+    }
+    err := s.port.Close()
+    s.port = nil
+    return err
+}
+
+// SetBaud re-opens the serial device at the new baud rate.
+func (s *serialPort) SetBaud(rate uint) error {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    if s.port != nil {
+        s.port.Close()
+        s.port = nil
+    }
+    return s.open(rate)
+}
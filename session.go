@@ -0,0 +1,275 @@
+package gocreate
+
+import (
+    "bufio"
+    "context"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "sync"
+    "time"
+)
+
+// sessionMagic identifies a session file, and is followed by a version byte.
+var sessionMagic = []byte("GOCS")
+
+const sessionVersion = 1
+
+// maxSessionData is the largest block of data in a session file, which is far larger
+// than any single read or write on a connection.  It stops a corrupt file from causing
+// a huge allocation.
+const maxSessionData = 1 << 20
+
+// SessionEvent is a block of data in a recorded session.
+//
+// Offset is the time since the start of the session.
+type SessionEvent struct {
+    Offset    time.Duration
+    Direction Direction
+    Data      []byte
+}
+
+// Recorder records the traffic on a connection to a compact session file.  Its Trace
+// method is a Tracer, so a recording is started with:
+//  conn.SetTracer(recorder.Trace)
+//
+// Each event is stored as a direction byte, the time since the previous event in
+// microseconds and the data length as unsigned varints, and then the data itself.  An
+// event with more than 1 MiB of data stops the recording with an error.
+type Recorder struct {
+    lock  sync.Mutex
+    w     io.Writer
+    start time.Time
+    last  time.Duration
+    err   error
+}
+
+// NewRecorder creates a recorder which writes a session to w.
+func NewRecorder(w io.Writer) (*Recorder, error) {
+    header := append(append([]byte(nil), sessionMagic...), sessionVersion)
+    if _, err := w.Write(header); err != nil {
+        return nil, err
+    }
+    return &Recorder{w: w}, nil
+}
+
+// Trace records a trace event.  Write errors stop the recording and are reported by
+// Err.
+func (r *Recorder) Trace(event TraceEvent) {
+    r.lock.Lock()
+    defer r.lock.Unlock()
+
+    if r.err != nil {
+        return
+    }
+    if len(event.Data) > maxSessionData {
+        r.err = fmt.Errorf("Session event of %d bytes is too large", len(event.Data))
+        return
+    }
+    if r.start.IsZero() {
+        r.start = event.Time
+    }
+    offset := event.Time.Sub(r.start)
+    if offset < r.last {
+        offset = r.last
+    }
+
+    record := []byte{byte(event.Direction)}
+    record = binary.AppendUvarint(record, uint64((offset-r.last)/time.Microsecond))
+    record = binary.AppendUvarint(record, uint64(len(event.Data)))
+    record = append(record, event.Data...)
+    r.last = offset - offset%time.Microsecond
+    _, r.err = r.w.Write(record)
+}
+
+// Err returns the first error encountered while writing the session, if any.
+func (r *Recorder) Err() error {
+    r.lock.Lock()
+    defer r.lock.Unlock()
+    return r.err
+}
+
+// ReadSession reads all of the events from a session file written by a Recorder.
+func ReadSession(r io.Reader) ([]SessionEvent, error) {
+    br := bufio.NewReader(r)
+    header := make([]byte, len(sessionMagic)+1)
+    if _, err := io.ReadFull(br, header); err != nil {
+        return nil, err
+    }
+    if string(header[:len(sessionMagic)]) != string(sessionMagic) {
+        return nil, errors.New("Not a session file")
+    }
+    if header[len(sessionMagic)] != sessionVersion {
+        return nil, fmt.Errorf("Unsupported session file version %d", header[len(sessionMagic)])
+    }
+
+    var events []SessionEvent
+    var offset time.Duration
+    for {
+        direction, err := br.ReadByte()
+        if err == io.EOF {
+            return events, nil
+        } else if err != nil {
+            return nil, err
+        }
+        if Direction(direction) != Outbound && Direction(direction) != Inbound {
+            return nil, fmt.Errorf("Invalid direction %d in session file", direction)
+        }
+
+        delta, err := binary.ReadUvarint(br)
+        if err != nil {
+            return nil, unexpectedEOF(err)
+        }
+        length, err := binary.ReadUvarint(br)
+        if err != nil {
+            return nil, unexpectedEOF(err)
+        }
+        if length > maxSessionData {
+            return nil, fmt.Errorf("Session event of %d bytes is too large", length)
+        }
+        data := make([]byte, length)
+        if _, err := io.ReadFull(br, data); err != nil {
+            return nil, unexpectedEOF(err)
+        }
+
+        offset += time.Duration(delta) * time.Microsecond
+        events = append(events, SessionEvent{Offset: offset, Direction: Direction(direction), Data: data})
+    }
+}
+
+func unexpectedEOF(err error) error {
+    if err == io.EOF {
+        return io.ErrUnexpectedEOF
+    }
+    return err
+}
+
+// Replay sends the outbound data of a recorded session to the Create, with the same
+// timing as the original session.  The data is decoded back into commands which are sent
+// like any others, so emergency stops, interceptors and the connection's baud rate
+// tracking all apply.  Sensor requests wait for their replies, which are discarded.  If
+// the session contains data which cannot be decoded, nothing is sent.
+func (c *Connection) Replay(ctx context.Context, events []SessionEvent) error {
+    cmds := make([][]Command, len(events))
+    for i, e := range events {
+        if e.Direction != Outbound {
+            continue
+        }
+
+        var err error
+        if cmds[i], err = ParseCommands(e.Data); err != nil {
+            return err
+        }
+    }
+
+    start := time.Now()
+    for i, e := range events {
+        if e.Direction != Outbound {
+            continue
+        }
+
+        if wait := e.Offset - time.Since(start); wait > 0 {
+            select {
+            case <-time.After(wait):
+            case <-ctx.Done():
+                return ctx.Err()
+            }
+        }
+        for _, cmd := range cmds[i] {
+            if err := c.Send(ctx, cmd); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// ReplayTransport is an in-memory transport which plays back the inbound data of a
+// recorded session, so that applications and tests can run against recorded sensor
+// data without a Create.  Each block of inbound data becomes available to read once as
+// much data has been written to the transport as had been sent before it in the
+// original session.  The original timing is not reproduced.
+type ReplayTransport struct {
+    lock    sync.Mutex
+    cond    *sync.Cond
+    events  []SessionEvent
+    written []byte
+    sent    int
+    pending []byte
+    closed  bool
+}
+
+// NewReplayTransport creates a transport which plays back the given session.
+func NewReplayTransport(events []SessionEvent) *ReplayTransport {
+    t := &ReplayTransport{events: events}
+    t.cond = sync.NewCond(&t.lock)
+    t.release()
+    return t
+}
+
+// release makes available any inbound data whose preceding outbound data has been
+// written.
+func (t *ReplayTransport) release() {
+    for len(t.events) > 0 {
+        e := t.events[0]
+        if e.Direction == Outbound {
+            if len(t.written) < t.sent+len(e.Data) {
+                return
+            }
+            t.sent += len(e.Data)
+        } else {
+            t.pending = append(t.pending, e.Data...)
+        }
+        t.events = t.events[1:]
+    }
+}
+
+// Read reads the inbound data of the session, blocking until more is available.  Once
+// every event has been played back, Read blocks until the transport is closed.
+func (t *ReplayTransport) Read(p []byte) (int, error) {
+    t.lock.Lock()
+    defer t.lock.Unlock()
+
+    for len(t.pending) == 0 && !t.closed {
+        t.cond.Wait()
+    }
+    if len(t.pending) == 0 {
+        return 0, io.EOF
+    }
+    n := copy(p, t.pending)
+    t.pending = t.pending[n:]
+    return n, nil
+}
+
+// Write records outbound data, and releases any inbound data which followed it in the
+// session.
+func (t *ReplayTransport) Write(p []byte) (int, error) {
+    t.lock.Lock()
+    defer t.lock.Unlock()
+
+    if t.closed {
+        return 0, errors.New("Replay transport is closed")
+    }
+    t.written = append(t.written, p...)
+    t.release()
+    t.cond.Broadcast()
+    return len(p), nil
+}
+
+// Close closes the transport.
+func (t *ReplayTransport) Close() error {
+    t.lock.Lock()
+    t.closed = true
+    t.lock.Unlock()
+    t.cond.Broadcast()
+    return nil
+}
+
+// Written returns all of the data written to the transport, which can be compared with
+// the session's outbound data to check that an application behaved the same way.
+func (t *ReplayTransport) Written() []byte {
+    t.lock.Lock()
+    defer t.lock.Unlock()
+    return append([]byte(nil), t.written...)
+}
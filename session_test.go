@@ -0,0 +1,149 @@
+package gocreate
+
+import (
+    "bytes"
+    "context"
+    "github.com/stretchr/testify/assert"
+    "io"
+    "testing"
+    "time"
+)
+
+func TestRecordSession(t *testing.T) {
+    var buf bytes.Buffer
+    recorder, err := NewRecorder(&buf)
+    if !assert.Nil(t, err) {
+        return
+    }
+
+    dev := newRobotTestDevice(57600)
+    conn := NewConnection(dev, 57600)
+    conn.SetTracer(recorder.Trace)
+    ctx := context.Background()
+
+    assert.Nil(t, conn.Send(ctx, Start()))
+    assert.Nil(t, conn.Send(ctx, Safe()))
+    reply, err := conn.Query(ctx, PacketOIMode)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{byte(ModeSafe)})
+    assert.Nil(t, conn.Close())
+    assert.Nil(t, recorder.Err())
+
+    events, err := ReadSession(&buf)
+    if !assert.Nil(t, err) || !assert.Len(t, events, 4) {
+        return
+    }
+    assert.Equal(t, events[0].Direction, Outbound)
+    assert.Equal(t, events[0].Data, []byte{128})
+    assert.Equal(t, events[1].Data, []byte{131})
+    assert.Equal(t, events[2].Data, []byte{142, 35})
+    assert.Equal(t, events[3].Direction, Inbound)
+    assert.Equal(t, events[3].Data, []byte{byte(ModeSafe)})
+    for i := 1; i < len(events); i++ {
+        assert.True(t, events[i].Offset >= events[i-1].Offset, "Expected event offsets to increase")
+    }
+}
+
+func TestRecordSessionTooLarge(t *testing.T) {
+    var buf bytes.Buffer
+    recorder, err := NewRecorder(&buf)
+    if !assert.Nil(t, err) {
+        return
+    }
+
+    recorder.Trace(TraceEvent{Time: time.Now(), Direction: Outbound, Data: make([]byte, maxSessionData+1)})
+    assert.NotNil(t, recorder.Err(), "Expected an oversized event to stop the recording")
+    assert.Equal(t, buf.Len(), len(sessionMagic)+1, "Expected nothing to be recorded")
+}
+
+func TestReadSessionErrors(t *testing.T) {
+    _, err := ReadSession(bytes.NewReader([]byte("nope!")))
+    assert.NotNil(t, err, "Expected reading a file with the wrong header to fail")
+
+    _, err = ReadSession(bytes.NewReader([]byte{'G', 'O', 'C', 'S', 9}))
+    assert.NotNil(t, err, "Expected reading an unsupported version to fail")
+
+    _, err = ReadSession(bytes.NewReader([]byte{'G', 'O', 'C', 'S', 1, 0, 5, 3, 128}))
+    assert.NotNil(t, err, "Expected reading a truncated record to fail")
+
+    _, err = ReadSession(bytes.NewReader([]byte{'G', 'O', 'C', 'S', 1, 0, 5, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F, 128}))
+    assert.NotNil(t, err, "Expected reading an oversized record to fail")
+
+    _, err = ReadSession(bytes.NewReader([]byte{'G', 'O', 'C', 'S', 1, 0, 5, 0x80, 0x80, 0x40, 128}))
+    assert.Equal(t, err, io.ErrUnexpectedEOF, "Expected reading a truncated record within the limit to fail")
+
+    events, err := ReadSession(bytes.NewReader([]byte{'G', 'O', 'C', 'S', 1, 0, 5, 1, 128, 1, 0x90, 0x4E, 1, 2}))
+    assert.Nil(t, err)
+    assert.Equal(t, events, []SessionEvent{
+        {Offset: 5 * time.Microsecond, Direction: Outbound, Data: []byte{128}},
+        {Offset: 10005 * time.Microsecond, Direction: Inbound, Data: []byte{2}},
+    })
+}
+
+func TestReplayTransport(t *testing.T) {
+    events := []SessionEvent{
+        {Offset: 0, Direction: Outbound, Data: []byte{128}},
+        {Offset: time.Millisecond, Direction: Outbound, Data: []byte{142, 35}},
+        {Offset: 2 * time.Millisecond, Direction: Inbound, Data: []byte{byte(ModePassive)}},
+        {Offset: 3 * time.Millisecond, Direction: Outbound, Data: []byte{142, 19}},
+        {Offset: 4 * time.Millisecond, Direction: Inbound, Data: []byte{0xFF, 0xF6}},
+    }
+    transport := NewReplayTransport(events)
+    conn := NewConnection(transport, 57600)
+    ctx := context.Background()
+
+    assert.Nil(t, conn.Send(ctx, Start()))
+    reply, err := conn.Query(ctx, PacketOIMode)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{byte(ModePassive)})
+    reply, err = conn.Query(ctx, PacketDistance)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{0xFF, 0xF6}, "Expected the recorded sensor data to be played back")
+    assert.Nil(t, conn.Close())
+
+    assert.Equal(t, transport.Written(), []byte{128, 142, 35, 142, 19})
+}
+
+func TestReplay(t *testing.T) {
+    events := []SessionEvent{
+        {Offset: 0, Direction: Outbound, Data: []byte{128, 131}},
+        {Offset: 5 * time.Millisecond, Direction: Inbound, Data: []byte{1}},
+        {Offset: 20 * time.Millisecond, Direction: Outbound, Data: []byte{137, 0, 100, 0x80, 0}},
+    }
+    conn, dev := newTestConnection()
+
+    start := time.Now()
+    assert.Nil(t, conn.Replay(context.Background(), events))
+    assert.True(t, time.Since(start) >= 20*time.Millisecond, "Expected the original timing to be reproduced")
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, dev.Written(), []byte{128, 131, 137, 0, 100, 0x80, 0})
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    conn, _ = newTestConnection()
+    assert.Equal(t, conn.Replay(ctx, events[1:]), context.Canceled)
+    assert.Nil(t, conn.Close())
+}
+
+func TestReplayEmergencyStop(t *testing.T) {
+    events := []SessionEvent{
+        {Offset: 0, Direction: Outbound, Data: []byte{128, 131}},
+        {Offset: time.Millisecond, Direction: Outbound, Data: []byte{145, 0, 100, 0, 100}},
+    }
+    conn, dev := newTestConnection()
+    assert.Nil(t, conn.EmergencyStop(nil))
+    assert.Equal(t, conn.Replay(context.Background(), events), ErrEmergencyStop, "Expected motion in the session to be refused")
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, dev.Written(), []byte{145, 0, 0, 0, 0, 128, 131})
+}
+
+func TestReplayInvalid(t *testing.T) {
+    events := []SessionEvent{
+        {Offset: 0, Direction: Outbound, Data: []byte{128, 131}},
+        {Offset: 0, Direction: Outbound, Data: []byte{137, 0}},
+    }
+    conn, dev := newTestConnection()
+    assert.NotNil(t, conn.Replay(context.Background(), events), "Expected a truncated command to be rejected")
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, len(dev.Written()), 0, "Expected nothing to be sent")
+}
@@ -0,0 +1,113 @@
+package gocreate
+
+import (
+    "context"
+    "os"
+    "os/signal"
+    "sync"
+    "syscall"
+    "time"
+)
+
+// shutdownTimeout limits how long Close and the signal hook spend on a safe shutdown.
+const shutdownTimeout = time.Second
+
+// shutdownCommands returns the commands which bring the Create to a safe state: motors
+// stopped, low side drivers, digital outputs and LEDs off, any sensor stream paused, and
+// the OI in Passive mode.
+func shutdownCommands() []Command {
+    return []Command{
+        DriveDirect(0, 0),
+        LowSideDrivers(0),
+        DigitalOutputs(0),
+        Leds(false, false, 0, 0),
+        PauseResumeStream(false),
+        Start(),
+    }
+}
+
+// Shutdown brings the Create to a safe state without closing the connection: the
+// motors are stopped, the low side drivers, digital outputs and LEDs are turned off,
+// any sensor stream is paused, and the OI is switched to Passive mode.  The commands
+// are written after any already queued, without interruption, and are sent even if the
+// connection is emergency stopped.
+func (c *Connection) Shutdown(ctx context.Context) error {
+    return c.do(ctx, func() error {
+        for _, cmd := range shutdownCommands() {
+            if err := c.sendCommand(cmd); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// SetSafeShutdown controls whether Close performs a safe shutdown (see Shutdown) before
+// closing the transport.  It is disabled by default.
+func (c *Connection) SetSafeShutdown(enabled bool) {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    c.safeClose = enabled
+}
+
+func (c *Connection) safeShutdown() error {
+    c.stateLock.Lock()
+    enabled := c.safeClose
+    c.stateLock.Unlock()
+
+    if !enabled {
+        return nil
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+    defer cancel()
+
+    err := c.Shutdown(ctx)
+    if err == ErrClosed {
+        return nil
+    }
+    return err
+}
+
+// ShutdownOnSignal installs a hook which performs a safe shutdown (see Shutdown) and
+// closes the connection when the process receives one of the given signals, or SIGINT
+// or SIGTERM if none are given.  The signal is then raised again, so that the process
+// terminates as it would have without the hook, unless the application is also
+// handling it.  The returned function removes the hook.
+func (c *Connection) ShutdownOnSignal(signals ...os.Signal) (stop func()) {
+    if len(signals) == 0 {
+        signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+    }
+
+    ch := make(chan os.Signal, 1)
+    done := make(chan struct{})
+    signal.Notify(ch, signals...)
+    go c.awaitSignal(ch, done, reraise)
+
+    var once sync.Once
+    return func() {
+        once.Do(func() {
+            signal.Stop(ch)
+            close(done)
+        })
+    }
+}
+
+func (c *Connection) awaitSignal(ch chan os.Signal, done chan struct{}, exit func(sig os.Signal)) {
+    select {
+    case sig := <-ch:
+        signal.Stop(ch)
+        c.SetSafeShutdown(true)
+        c.Close()
+        exit(sig)
+    case <-done:
+    }
+}
+
+// reraise delivers a signal to the process again once the hook's handler has been
+// removed.  If that is not possible, the process exits.
+func reraise(sig os.Signal) {
+    if p, err := os.FindProcess(os.Getpid()); err == nil && p.Signal(sig) == nil {
+        return
+    }
+    os.Exit(1)
+}
@@ -0,0 +1,81 @@
+package gocreate
+
+import (
+    "bytes"
+    "context"
+    "github.com/stretchr/testify/assert"
+    "os"
+    "testing"
+    "time"
+)
+
+func shutdownBytes() []byte {
+    var data []byte
+    for _, cmd := range shutdownCommands() {
+        data = append(data, cmd.Assemble()...)
+    }
+    return data
+}
+
+func TestShutdown(t *testing.T) {
+    conn, dev := newTestConnection()
+    assert.Nil(t, conn.Shutdown(context.Background()))
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, dev.Written(), []byte{145, 0, 0, 0, 0, 138, 0, 147, 0, 139, 0, 0, 0, 150, 0, 128})
+}
+
+func TestShutdownEmergencyStopped(t *testing.T) {
+    conn, dev := newTestConnection()
+    assert.Nil(t, conn.EmergencyStop(Safe()))
+    assert.Nil(t, conn.Shutdown(context.Background()))
+    assert.Nil(t, conn.Close())
+
+    expected := bytes.Join([][]byte{DriveDirect(0, 0).Assemble(), Safe().Assemble(), shutdownBytes()}, nil)
+    assert.Equal(t, dev.Written(), expected, "Expected the shutdown to be sent while emergency stopped")
+}
+
+func TestSafeClose(t *testing.T) {
+    dev := newTestDevice()
+    conn, err := Open("robot", WithTransport(dev), WithSafeShutdown())
+    if !assert.Nil(t, err) {
+        return
+    }
+
+    assert.Nil(t, conn.Send(context.Background(), DriveStraight(100)))
+    assert.Nil(t, conn.Close())
+    assert.Nil(t, conn.Close())
+    assert.Equal(t, dev.Written(), append(DriveStraight(100).Assemble(), shutdownBytes()...))
+}
+
+func TestSafeCloseFailure(t *testing.T) {
+    conn := NewConnection(&failingTestDevice{newTestDevice()}, 57600)
+    conn.SetSafeShutdown(true)
+    assert.NotNil(t, conn.Close(), "Expected a failed shutdown to be reported")
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+    conn, dev := newTestConnection()
+    ch := make(chan os.Signal, 1)
+    exited := make(chan os.Signal, 1)
+    go conn.awaitSignal(ch, make(chan struct{}), func(sig os.Signal) { exited <- sig })
+
+    ch <- os.Interrupt
+    select {
+    case sig := <-exited:
+        assert.Equal(t, sig, os.Interrupt)
+    case <-time.After(time.Second):
+        t.Fatal("Timed out waiting for the signal to be handled")
+    }
+    assert.Equal(t, conn.Send(context.Background(), Start()), ErrClosed)
+    assert.Equal(t, dev.Written(), shutdownBytes())
+}
+
+func TestShutdownOnSignalStop(t *testing.T) {
+    conn, dev := newTestConnection()
+    stop := conn.ShutdownOnSignal()
+    stop()
+    stop()
+
+    assert.Nil(t, conn.Close())
+    assert.Empty(t, dev.Written(), "Expected nothing to be sent without a signal")
+}
@@ -0,0 +1,562 @@
+package gocreate
+
+import (
+    "errors"
+    "io"
+    "math"
+    "sync"
+    "time"
+)
+
+const (
+    // simStreamPeriod is how often the Create sends a sensor stream frame.
+    simStreamPeriod = 15 * time.Millisecond
+    // simPollPeriod is how often a script checks whether a wait has finished.
+    simPollPeriod = 5 * time.Millisecond
+)
+
+// SimulatorState is a snapshot of the state of a simulated Create.
+//
+// X and Y are its position in mm, and Heading its direction in radians anticlockwise
+// from the X axis, relative to where the simulation started.
+//
+// RightVelocity and LeftVelocity are the wheel velocities in mm/s.  Velocity and Radius
+// are the values of the last Drive command.
+//
+// AdvanceLed, PlayLed, PowerColour and PowerIntensity are the states of the LEDs, and
+// LowSideDrivers and DigitalOutputs the states of the outputs, with one bit per output.
+//
+// SongNumber is the last song played, and SongPlaying whether it is still playing.
+// Streaming reports whether a sensor stream is being sent.
+type SimulatorState struct {
+    Mode           Mode
+    X              float64
+    Y              float64
+    Heading        float64
+    RightVelocity  int16
+    LeftVelocity   int16
+    Velocity       int16
+    Radius         int16
+    AdvanceLed     bool
+    PlayLed        bool
+    PowerColour    byte
+    PowerIntensity byte
+    LowSideDrivers byte
+    DigitalOutputs byte
+    SongNumber     byte
+    SongPlaying    bool
+    Streaming      bool
+}
+
+// simComputedPackets are the packets whose values come from the simulation, and which
+// cannot be set with SetSensor.
+var simComputedPackets = map[SensorPacket]bool{
+    PacketDistance:               true,
+    PacketAngle:                  true,
+    PacketCurrent:                true,
+    PacketOIMode:                 true,
+    PacketSongNumber:             true,
+    PacketSongPlaying:            true,
+    PacketStreamPackets:          true,
+    PacketRequestedVelocity:      true,
+    PacketRequestedRadius:        true,
+    PacketRequestedRightVelocity: true,
+    PacketRequestedLeftVelocity:  true,
+}
+
+// Simulator is a virtual Create which speaks the OI protocol.  It implements
+// io.ReadWriteCloser and BaudSetter, so it can be used as the transport of a Connection
+// (see NewConnection and WithTransport), or copied to and from a PTY for other
+// applications.
+//
+// The simulator follows the OI modes, drives a differential-drive kinematic model from
+// Drive and Drive Direct commands, records the LEDs, outputs and songs, runs scripts,
+// and answers sensor requests and streams.  Like a real Create, it ignores everything
+// but Start until the OI has been started, ignores actuator commands in Passive mode,
+// and only understands data sent at its current baud rate, which starts at 57600.
+type Simulator struct {
+    lock     sync.Mutex
+    cond     *sync.Cond
+    now      func() time.Time
+    closed   bool
+    stop     chan struct{}
+    lineRate uint
+    rate     uint
+    input    []byte
+    output   []byte
+    state    SimulatorState
+    updated  time.Time
+    distance float64
+    angle    float64
+    odometer float64
+    turned   float64
+    songs    [16][]Note
+    songEnd  time.Time
+    script   []byte
+    stream   []SensorPacket
+    sensors  map[SensorPacket]int
+}
+
+// NewSimulator creates a simulated Create, stationary at the origin with the OI off.
+func NewSimulator() *Simulator {
+    s := &Simulator{
+        now:      time.Now,
+        stop:     make(chan struct{}),
+        lineRate: 57600,
+        rate:     57600,
+        sensors: map[SensorPacket]int{
+            PacketIrByte:             255,
+            PacketVoltage:            16000,
+            PacketBatteryTemperature: 25,
+            PacketBatteryCharge:      2500,
+            PacketBatteryCapacity:    2702,
+        },
+    }
+    s.cond = sync.NewCond(&s.lock)
+    s.updated = s.now()
+    go s.streamer()
+    return s
+}
+
+// Read returns data sent by the simulated Create, blocking until there is some.
+func (s *Simulator) Read(p []byte) (int, error) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    for len(s.output) == 0 && !s.closed {
+        s.cond.Wait()
+    }
+    if len(s.output) == 0 {
+        return 0, io.EOF
+    }
+    n := copy(p, s.output)
+    s.output = s.output[n:]
+    return n, nil
+}
+
+// Write delivers OI commands to the simulated Create.  Data sent at a different baud
+// rate from the Create's is lost.
+func (s *Simulator) Write(p []byte) (int, error) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    if s.closed {
+        return 0, io.ErrClosedPipe
+    }
+    if s.lineRate != s.rate {
+        return len(p), nil
+    }
+
+    s.input = append(s.input, p...)
+    for len(s.input) > 0 && s.lineRate == s.rate {
+        length, ok := commandLength(s.input)
+        if !ok {
+            s.input = s.input[1:]
+            continue
+        }
+        if length == 0 || length > len(s.input) {
+            break
+        }
+        cmd := s.input[:length]
+        s.input = s.input[length:]
+        s.execute(cmd)
+    }
+    if s.lineRate != s.rate {
+        s.input = nil
+    }
+    s.cond.Broadcast()
+    return len(p), nil
+}
+
+// Close stops the simulation.
+func (s *Simulator) Close() error {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    if !s.closed {
+        s.closed = true
+        close(s.stop)
+        s.cond.Broadcast()
+    }
+    return nil
+}
+
+// SetBaud changes the baud rate of the simulated serial line.
+func (s *Simulator) SetBaud(rate uint) error {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    s.lineRate = rate
+    s.input = nil
+    return nil
+}
+
+// State returns a snapshot of the simulated Create's state.
+func (s *Simulator) State() SimulatorState {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    s.advance()
+    return s.state
+}
+
+// SetSensor sets the value of a sensor packet, such as a bumper, cliff sensor, button
+// or battery level, which is not derived from the simulation.  Two-byte packets take
+// values from -32768 to 65535, and one-byte packets from -128 to 255.  As on a real
+// Create, a wheel drop or cliff in Safe mode stops the wheels and switches the OI to
+// Passive mode.
+func (s *Simulator) SetSensor(packet SensorPacket, value int) error {
+    size := packet.Size()
+    if _, group := packetGroups[packet]; group || size == 0 || simComputedPackets[packet] {
+        return errors.New("Sensor packet cannot be set")
+    }
+    if limit := 1 << (8 * uint(size)); value < -limit/2 || value >= limit {
+        return errors.New("Sensor value out of range")
+    }
+
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    s.advance()
+    s.sensors[packet] = value
+    if s.state.Mode == ModeSafe && s.hazard() {
+        s.state.Mode = ModePassive
+        s.setWheels(0, 0)
+    }
+    return nil
+}
+
+// hazard reports whether a wheel drop or cliff is being detected.
+func (s *Simulator) hazard() bool {
+    if s.sensors[PacketBumpsAndWheelDrops]&0x1C != 0 {
+        return true
+    }
+    for p := PacketCliffLeft; p <= PacketCliffRight; p++ {
+        if s.sensors[p] != 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// advance updates the kinematic model to the current time.  The caller must hold the
+// lock.
+func (s *Simulator) advance() {
+    now := s.now()
+    dt := now.Sub(s.updated).Seconds()
+    s.updated = now
+    if s.state.SongPlaying && !now.Before(s.songEnd) {
+        s.state.SongPlaying = false
+    }
+    if dt <= 0 {
+        return
+    }
+
+    right, left := float64(s.state.RightVelocity), float64(s.state.LeftVelocity)
+    v := (right + left) / 2
+    w := (right - left) / wheelBase
+    h := s.state.Heading
+    if w == 0 {
+        s.state.X += v * dt * math.Cos(h)
+        s.state.Y += v * dt * math.Sin(h)
+    } else {
+        r := v / w
+        next := h + w*dt
+        s.state.X += r * (math.Sin(next) - math.Sin(h))
+        s.state.Y -= r * (math.Cos(next) - math.Cos(h))
+        s.state.Heading = math.Remainder(next, 2*math.Pi)
+    }
+
+    s.distance += v * dt
+    s.odometer += v * dt
+    degrees := w * dt * 180 / math.Pi
+    s.angle += degrees
+    s.turned += degrees
+}
+
+func (s *Simulator) setWheels(right int16, left int16) {
+    s.state.RightVelocity = right
+    s.state.LeftVelocity = left
+}
+
+// drive converts a Drive command's velocity and radius into wheel velocities.
+func (s *Simulator) drive(velocity int16, radius int16) {
+    s.state.Velocity, s.state.Radius = velocity, radius
+    switch radius {
+    case -32768, 32767:
+        s.setWheels(velocity, velocity)
+    case -1:
+        s.setWheels(-velocity, velocity)
+    case 1:
+        s.setWheels(velocity, -velocity)
+    case 0:
+        // The centre of the Create cannot move along a path with no radius.
+        s.setWheels(0, 0)
+    default:
+        v, r := float64(velocity), float64(radius)
+        right := v * (r + wheelBase/2) / r
+        left := v * (r - wheelBase/2) / r
+        s.setWheels(clampVelocity(right), clampVelocity(left))
+    }
+}
+
+func clampVelocity(v float64) int16 {
+    return int16(math.Round(math.Max(-500, math.Min(500, v))))
+}
+
+func signed16(high byte, low byte) int16 {
+    return int16(uint16(high)<<8 | uint16(low))
+}
+
+// execute carries out a single complete command.  The caller must hold the lock.
+func (s *Simulator) execute(cmd []byte) {
+    s.advance()
+
+    mode := s.state.Mode
+    if cmd[0] != 128 && mode == ModeOff {
+        return
+    }
+    actuate := mode == ModeSafe || mode == ModeFull
+
+    switch cmd[0] {
+    case 128:
+        s.state.Mode = ModePassive
+    case 129:
+        if int(cmd[1]) < len(baudCodes) {
+            s.rate = baudCodes[cmd[1]]
+        }
+    case 131:
+        s.state.Mode = ModeSafe
+    case 132:
+        s.state.Mode = ModeFull
+    case 134, 135, 136, 143:
+        // Demos are not simulated, but they still switch the OI to Passive mode.
+        s.state.Mode = ModePassive
+        s.setWheels(0, 0)
+    case 137:
+        if actuate {
+            s.drive(signed16(cmd[1], cmd[2]), signed16(cmd[3], cmd[4]))
+        }
+    case 145:
+        if actuate {
+            s.setWheels(signed16(cmd[1], cmd[2]), signed16(cmd[3], cmd[4]))
+        }
+    case 138:
+        if actuate {
+            s.state.LowSideDrivers = cmd[1] & 0x07
+        }
+    case 144:
+        if actuate {
+            var bits byte
+            for i, duty := range []byte{cmd[3], cmd[2], cmd[1]} {
+                if duty > 0 {
+                    bits |= 1 << uint(i)
+                }
+            }
+            s.state.LowSideDrivers = bits
+        }
+    case 147:
+        if actuate {
+            s.state.DigitalOutputs = cmd[1] & 0x07
+        }
+    case 139:
+        if actuate {
+            s.state.AdvanceLed = cmd[1]&0x08 != 0
+            s.state.PlayLed = cmd[1]&0x02 != 0
+            s.state.PowerColour, s.state.PowerIntensity = cmd[2], cmd[3]
+        }
+    case 140:
+        if cmd[1] < 16 {
+            var song []Note
+            for i := 3; i+1 < len(cmd); i += 2 {
+                song = append(song, Note{Tone: cmd[i], Duration: cmd[i+1]})
+            }
+            s.songs[cmd[1]] = song
+        }
+    case 141:
+        if actuate && cmd[1] < 16 && len(s.songs[cmd[1]]) > 0 && !s.state.SongPlaying {
+            s.state.SongNumber = cmd[1]
+            s.state.SongPlaying = true
+            s.songEnd = s.updated.Add(time.Duration(SongDuration(s.songs[cmd[1]])) * time.Second / 64)
+        }
+    case 142:
+        s.output = append(s.output, s.packet(SensorPacket(cmd[1]))...)
+    case 149:
+        for _, p := range cmd[2:] {
+            s.output = append(s.output, s.packet(SensorPacket(p))...)
+        }
+    case 148:
+        s.stream = nil
+        for _, p := range cmd[2:] {
+            if SensorPacket(p).Size() > 0 {
+                s.stream = append(s.stream, SensorPacket(p))
+            }
+        }
+        s.state.Streaming = len(s.stream) > 0
+    case 150:
+        s.state.Streaming = cmd[1] == 1 && len(s.stream) > 0
+    case 152:
+        s.script = append([]byte(nil), cmd[2:]...)
+    case 153:
+        go s.runScript(append([]byte(nil), s.script...))
+    case 154:
+        s.output = append(s.output, byte(len(s.script)))
+        s.output = append(s.output, s.script...)
+    }
+}
+
+// packet returns the value of a sensor packet or packet group.  The caller must hold the
+// lock.
+func (s *Simulator) packet(p SensorPacket) []byte {
+    if group, ok := packetGroups[p]; ok {
+        var data []byte
+        for q := group[0]; q <= group[1]; q++ {
+            data = append(data, s.packet(q)...)
+        }
+        return data
+    }
+
+    var value int
+    switch p {
+    case PacketDistance:
+        value = int(math.Round(s.distance))
+        s.distance -= float64(value)
+    case PacketAngle:
+        value = int(math.Round(s.angle))
+        s.angle -= float64(value)
+    case PacketCurrent:
+        right, left := int(s.state.RightVelocity), int(s.state.LeftVelocity)
+        value = -150 - abs32(right) - abs32(left)
+    case PacketOIMode:
+        value = int(s.state.Mode)
+    case PacketSongNumber:
+        value = int(s.state.SongNumber)
+    case PacketSongPlaying:
+        if s.state.SongPlaying {
+            value = 1
+        }
+    case PacketStreamPackets:
+        value = len(s.stream)
+    case PacketRequestedVelocity:
+        value = int(s.state.Velocity)
+    case PacketRequestedRadius:
+        value = int(s.state.Radius)
+    case PacketRequestedRightVelocity:
+        value = int(s.state.RightVelocity)
+    case PacketRequestedLeftVelocity:
+        value = int(s.state.LeftVelocity)
+    default:
+        value = s.sensors[p]
+    }
+
+    if p.Size() == 2 {
+        return []byte{byte(value >> 8), byte(value)}
+    }
+    return []byte{byte(value)}
+}
+
+func abs32(v int) int {
+    if v < 0 {
+        return -v
+    }
+    return v
+}
+
+// streamer sends a sensor stream frame every 15ms while streaming is enabled.  Each
+// frame is the header byte 19, the number of bytes which follow before the checksum,
+// the ID and value of each packet, and a checksum which makes the frame sum to zero.
+func (s *Simulator) streamer() {
+    ticker := time.NewTicker(simStreamPeriod)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-s.stop:
+            return
+        case <-ticker.C:
+        }
+
+        s.lock.Lock()
+        if s.state.Streaming && s.state.Mode != ModeOff && s.lineRate == s.rate {
+            s.advance()
+            frame := []byte{19, 0}
+            for _, p := range s.stream {
+                frame = append(frame, byte(p))
+                frame = append(frame, s.packet(p)...)
+            }
+            frame[1] = byte(len(frame) - 2)
+
+            var sum byte
+            for _, b := range frame {
+                sum += b
+            }
+            s.output = append(s.output, append(frame, -sum)...)
+            s.cond.Broadcast()
+        }
+        s.lock.Unlock()
+    }
+}
+
+// runScript executes a script's commands in turn, waiting as its wait commands require.
+// Wait Event is not simulated, and does not wait.
+func (s *Simulator) runScript(script []byte) {
+    for len(script) > 0 {
+        length, ok := commandLength(script)
+        if !ok || length == 0 || length > len(script) {
+            return
+        }
+        cmd := script[:length]
+        script = script[length:]
+
+        switch cmd[0] {
+        case 155:
+            s.sleep(time.Duration(cmd[1]) * 100 * time.Millisecond)
+        case 156:
+            target := float64(signed16(cmd[1], cmd[2]))
+            s.waitFor(func() float64 { return s.odometer }, target)
+        case 157:
+            target := float64(signed16(cmd[1], cmd[2]))
+            s.waitFor(func() float64 { return s.turned }, target)
+        case 158:
+        default:
+            s.lock.Lock()
+            closed := s.closed
+            if !closed {
+                s.execute(cmd)
+                s.cond.Broadcast()
+            }
+            s.lock.Unlock()
+            if closed {
+                return
+            }
+        }
+    }
+}
+
+func (s *Simulator) sleep(d time.Duration) {
+    select {
+    case <-time.After(d):
+    case <-s.stop:
+    }
+}
+
+// waitFor waits until a cumulative measurement has changed by the target amount, in the
+// target's direction.
+func (s *Simulator) waitFor(measure func() float64, target float64) {
+    s.lock.Lock()
+    s.advance()
+    start := measure()
+    s.lock.Unlock()
+
+    for {
+        s.lock.Lock()
+        s.advance()
+        moved := measure() - start
+        closed := s.closed
+        s.lock.Unlock()
+
+        if closed || (target >= 0 && moved >= target) || (target < 0 && moved <= target) {
+            return
+        }
+        s.sleep(simPollPeriod)
+    }
+}
@@ -0,0 +1,226 @@
+package gocreate
+
+import (
+    "context"
+    "github.com/stretchr/testify/assert"
+    "math"
+    "sync"
+    "testing"
+    "time"
+)
+
+// simClock is a manually advanced clock for the simulator.
+type simClock struct {
+    lock sync.Mutex
+    now  time.Time
+}
+
+func (c *simClock) Now() time.Time {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    return c.now
+}
+
+func (c *simClock) Advance(d time.Duration) {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    c.now = c.now.Add(d)
+}
+
+func newClockedSimulator() (*Simulator, *simClock) {
+    clock := &simClock{now: time.Unix(0, 0)}
+    sim := NewSimulator()
+    sim.lock.Lock()
+    sim.now = clock.Now
+    sim.updated = clock.Now()
+    sim.lock.Unlock()
+    return sim, clock
+}
+
+func send(sim *Simulator, cmds ...Command) {
+    for _, cmd := range cmds {
+        sim.Write(cmd.Assemble())
+    }
+}
+
+func query(sim *Simulator, packet SensorPacket) []byte {
+    send(sim, Sensors(packet))
+    reply := make([]byte, packet.Size())
+    for n := 0; n < len(reply); {
+        m, err := sim.Read(reply[n:])
+        if err != nil {
+            return nil
+        }
+        n += m
+    }
+    return reply
+}
+
+func TestSimulatorConnection(t *testing.T) {
+    sim := NewSimulator()
+    sim.rate = 19200
+    conn, err := Open("sim", WithTransport(sim), WithBaud(0), WithStartMode(ModeFull))
+    if !assert.Nil(t, err) {
+        return
+    }
+    ctx := context.Background()
+    assert.Equal(t, conn.CurrentBaud(), uint(19200))
+
+    assert.Nil(t, conn.SetBaud(ctx, 115200))
+    reply, err := conn.Query(ctx, PacketOIMode)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{byte(ModeFull)})
+
+    song := []Note{{Tone: 60, Duration: 64}}
+    assert.Nil(t, conn.SendMany(ctx, []Command{Song(2, song), PlaySong(2), Leds(true, false, 128, 255)}))
+    reply, err = conn.Query(ctx, PacketGroup5)
+    assert.Nil(t, err)
+    assert.Equal(t, reply[:3], []byte{byte(ModeFull), 2, 1}, "Expected the song to be playing")
+
+    assert.Nil(t, conn.Send(ctx, DriveDirect(-100, 200)))
+    assert.Nil(t, conn.Close())
+
+    state := sim.State()
+    assert.Equal(t, sim.rate, uint(115200))
+    assert.Equal(t, state.Mode, ModeFull)
+    assert.True(t, state.AdvanceLed)
+    assert.False(t, state.PlayLed)
+    assert.Equal(t, state.PowerColour, byte(128))
+    assert.Equal(t, state.RightVelocity, int16(-100))
+    assert.Equal(t, state.LeftVelocity, int16(200))
+}
+
+func TestSimulatorModes(t *testing.T) {
+    sim, _ := newClockedSimulator()
+    defer sim.Close()
+
+    send(sim, Full(), Sensors(PacketOIMode))
+    assert.Equal(t, sim.State().Mode, ModeOff, "Expected commands to be ignored until the OI is started")
+    send(sim, Start(), DriveDirect(100, 100), Leds(true, true, 0, 0))
+    assert.Equal(t, query(sim, PacketOIMode), []byte{byte(ModePassive)})
+    state := sim.State()
+    assert.Equal(t, state.RightVelocity, int16(0), "Expected drive commands to be ignored in Passive mode")
+    assert.False(t, state.AdvanceLed)
+
+    send(sim, Safe(), DriveDirect(100, 100))
+    assert.Equal(t, query(sim, PacketOIMode), []byte{byte(ModeSafe)})
+    assert.Nil(t, sim.SetSensor(PacketCliffFrontLeft, 1))
+    state = sim.State()
+    assert.Equal(t, state.Mode, ModePassive, "Expected a cliff to end Safe mode")
+    assert.Equal(t, state.RightVelocity, int16(0))
+
+    assert.Nil(t, sim.SetSensor(PacketBatteryCharge, 1200))
+    assert.Equal(t, query(sim, PacketBatteryCharge), []byte{0x04, 0xB0})
+    assert.NotNil(t, sim.SetSensor(PacketDistance, 5), "Expected computed packets to be refused")
+    assert.NotNil(t, sim.SetSensor(PacketGroup1, 0))
+    assert.NotNil(t, sim.SetSensor(PacketWall, 256))
+}
+
+func TestSimulatorKinematics(t *testing.T) {
+    sim, clock := newClockedSimulator()
+    defer sim.Close()
+    send(sim, Start(), Full())
+
+    send(sim, DriveDirect(100, 100))
+    clock.Advance(2 * time.Second)
+    state := sim.State()
+    assert.InDelta(t, state.X, 200, 0.001)
+    assert.InDelta(t, state.Y, 0, 0.001)
+    assert.Equal(t, query(sim, PacketDistance), []byte{0, 200})
+    assert.Equal(t, query(sim, PacketDistance), []byte{0, 0}, "Expected the distance to be reset when read")
+
+    send(sim, Spin(100, false))
+    clock.Advance(time.Second)
+    state = sim.State()
+    assert.InDelta(t, state.Heading, 200.0/wheelBase, 0.001)
+    assert.InDelta(t, state.X, 200, 0.001)
+    assert.Equal(t, query(sim, PacketAngle), []byte{0, 44})
+
+    send(sim, Drive(200, 500))
+    state = sim.State()
+    assert.Equal(t, state.RightVelocity, int16(252))
+    assert.Equal(t, state.LeftVelocity, int16(148))
+    assert.Equal(t, query(sim, PacketRequestedRadius), []byte{0x01, 0xF4})
+
+    // Follow the arc for about a quarter circle.
+    start := state
+    elapsed := 4 * time.Second
+    clock.Advance(elapsed)
+    state = sim.State()
+    w := (252.0 - 148.0) / wheelBase
+    r := 200 / w
+    turned := w * elapsed.Seconds()
+    assert.InDelta(t, state.Heading-start.Heading, turned, 0.001)
+    assert.InDelta(t, math.Hypot(state.X-start.X, state.Y-start.Y), 2*r*math.Sin(turned/2), 0.001)
+}
+
+func TestSimulatorZeroRadius(t *testing.T) {
+    sim, clock := newClockedSimulator()
+    defer sim.Close()
+    send(sim, Start(), Full())
+
+    for _, velocity := range []int16{100, 0, -100} {
+        send(sim, Drive(velocity, 0))
+        clock.Advance(time.Second)
+        state := sim.State()
+        assert.Equal(t, state.RightVelocity, int16(0), "Expected the Create to stay still")
+        assert.Equal(t, state.LeftVelocity, int16(0), "Expected the Create to stay still")
+        assert.Equal(t, state.Velocity, velocity)
+        assert.InDelta(t, state.X, 0, 0.001)
+        assert.InDelta(t, state.Heading, 0, 0.001)
+    }
+}
+
+func TestSimulatorStream(t *testing.T) {
+    sim := NewSimulator()
+    defer sim.Close()
+    send(sim, Start(), Stream(PacketOIMode, PacketVoltage))
+
+    frame := make([]byte, 8)
+    for n := 0; n < len(frame); {
+        m, err := sim.Read(frame[n:])
+        if !assert.Nil(t, err) {
+            return
+        }
+        n += m
+    }
+    assert.Equal(t, frame[:7], []byte{19, 5, 35, byte(ModePassive), 22, 0x3E, 0x80})
+    var sum byte
+    for _, b := range frame {
+        sum += b
+    }
+    assert.Equal(t, sum, byte(0), "Expected the frame checksum to be valid")
+
+    send(sim, PauseResumeStream(false))
+    assert.False(t, sim.State().Streaming)
+    send(sim, PauseResumeStream(true))
+    assert.True(t, sim.State().Streaming)
+    send(sim, Stream())
+    assert.False(t, sim.State().Streaming)
+}
+
+func TestSimulatorScript(t *testing.T) {
+    sim := NewSimulator()
+    defer sim.Close()
+
+    script := []byte{145, 1, 244, 1, 244, 156, 0, 50, 145, 0, 0, 0, 0}
+    send(sim, Start(), Full())
+    sim.Write(append([]byte{152, byte(len(script))}, script...))
+    sim.Write([]byte{154})
+    shown := make([]byte, len(script)+1)
+    for n := 0; n < len(shown); {
+        m, _ := sim.Read(shown[n:])
+        n += m
+    }
+    assert.Equal(t, shown, append([]byte{byte(len(script))}, script...))
+
+    sim.Write([]byte{153})
+    deadline := time.Now().Add(time.Second)
+    for sim.State().RightVelocity != 0 || sim.State().X == 0 {
+        if time.Now().After(deadline) {
+            t.Fatal("Timed out waiting for the script to finish")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    assert.True(t, sim.State().X >= 50, "Expected the script to wait for the distance")
+}
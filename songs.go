@@ -0,0 +1,149 @@
+package gocreate
+
+import (
+    "context"
+    "fmt"
+    "sync"
+)
+
+// songSlotCount is the number of song slots available on the Create.
+const songSlotCount = 16
+
+type songSlot struct {
+    name string
+    song []Note
+    used uint64
+}
+
+// SongManager keeps track of which named melodies are programmed into which of the
+// Create's 16 song slots, so that several parts of an application can share the slots
+// without clobbering each other.  Slots are allocated in least-recently-used order and a
+// melody is only re-programmed into the Create when it is no longer present in a slot.
+//
+// Songs should not be programmed directly with the Song command on a connection that is
+// managed by a SongManager, since the manager cannot track those changes.
+type SongManager struct {
+    conn     *Connection
+    lock     sync.Mutex
+    melodies map[string][]Note
+    slots    [songSlotCount]songSlot
+    clock    uint64
+}
+
+// NewSongManager creates a song manager for the given connection.  Most applications
+// should use the connection's shared manager (see Connection.Songs) instead.
+func NewSongManager(conn *Connection) *SongManager {
+    return &SongManager{conn: conn, melodies: make(map[string][]Note)}
+}
+
+// Define registers a named melody with the manager.  The melody must be between 1 and
+// 16 notes long.  Redefining an existing name replaces its notes, and the new notes will
+// be programmed into the Create the next time the melody is played.
+func (m *SongManager) Define(name string, song []Note) error {
+    if len(song) < 1 || len(song) > 16 {
+        return fmt.Errorf("Song %q must have between 1 and 16 notes, not %d", name, len(song))
+    }
+
+    m.lock.Lock()
+    defer m.lock.Unlock()
+
+    m.melodies[name] = append([]Note(nil), song...)
+    return nil
+}
+
+// Slot reports which song slot the named melody is currently programmed into, if any.
+func (m *SongManager) Slot(name string) (byte, bool) {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+
+    i := m.find(name)
+    if i < 0 {
+        return 0, false
+    }
+    return byte(i), true
+}
+
+// Load ensures that the named melody is programmed into a song slot, programming it into
+// the least recently used slot if necessary, and returns the slot number.
+func (m *SongManager) Load(ctx context.Context, name string) (byte, error) {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+
+    return m.load(ctx, name)
+}
+
+// Play plays the named melody, first programming it into a song slot if necessary.
+func (m *SongManager) Play(ctx context.Context, name string) error {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+
+    slot, err := m.load(ctx, name)
+    if err != nil {
+        return err
+    }
+
+    return m.conn.Send(ctx, PlaySong(slot))
+}
+
+// Forget clears the manager's record of the song slots, so that every melody is
+// re-programmed the next time it is played.  This is useful if the Create has been
+// reset or its songs have been changed by something other than this manager.
+func (m *SongManager) Forget() {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+
+    m.slots = [songSlotCount]songSlot{}
+}
+
+func (m *SongManager) find(name string) int {
+    song, ok := m.melodies[name]
+    if !ok {
+        return -1
+    }
+    for i := range m.slots {
+        if m.slots[i].name == name && notesEqual(m.slots[i].song, song) {
+            return i
+        }
+    }
+    return -1
+}
+
+func (m *SongManager) load(ctx context.Context, name string) (byte, error) {
+    song, ok := m.melodies[name]
+    if !ok {
+        return 0, fmt.Errorf("Song %q has not been defined", name)
+    }
+
+    m.clock++
+    if i := m.find(name); i >= 0 {
+        m.slots[i].used = m.clock
+        return byte(i), nil
+    }
+
+    victim := 0
+    for i := range m.slots {
+        if m.slots[i].used < m.slots[victim].used {
+            victim = i
+        }
+    }
+
+    if err := m.conn.Send(ctx, Song(byte(victim), song)); err != nil {
+        // The slot's contents are unknown if the song could not be programmed.
+        m.slots[victim] = songSlot{}
+        return 0, err
+    }
+    m.slots[victim] = songSlot{name: name, song: song, used: m.clock}
+    return byte(victim), nil
+}
+
+func notesEqual(a []Note, b []Note) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
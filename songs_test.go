@@ -0,0 +1,72 @@
+package gocreate
+
+import (
+    "context"
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestSongManagerPlay(t *testing.T) {
+    ctx := context.Background()
+    conn, dev := newTestConnection()
+    songs := conn.Songs()
+    assert.True(t, songs == conn.Songs(), "Expected the connection to share one song manager")
+
+    assert.Nil(t, songs.Define("victory", []Note{{72, 16}, {76, 16}, {79, 32}}))
+    assert.Nil(t, songs.Define("defeat", []Note{{60, 64}}))
+
+    assert.Nil(t, songs.Play(ctx, "victory"))
+    assert.Nil(t, songs.Play(ctx, "victory"))
+    assert.Nil(t, songs.Play(ctx, "defeat"))
+    slot, ok := songs.Slot("defeat")
+    assert.True(t, ok)
+    assert.Equal(t, slot, byte(1))
+
+    assert.NotNil(t, songs.Play(ctx, "unknown"), "Expected playing an undefined song to fail")
+
+    conn.Close()
+    expected := []byte{140, 0, 3, 72, 16, 76, 16, 79, 32, 141, 0, 141, 0, 140, 1, 1, 60, 64, 141, 1}
+    assert.Equal(t, dev.Written(), expected, "Songs should only be programmed when not already loaded")
+}
+
+func TestSongManagerLRU(t *testing.T) {
+    ctx := context.Background()
+    conn, dev := newTestConnection()
+    songs := conn.Songs()
+
+    names := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p", "q"}
+    for i, name := range names {
+        assert.Nil(t, songs.Define(name, []Note{{byte(40 + i), 8}}))
+    }
+    for _, name := range names[:16] {
+        _, err := songs.Load(ctx, name)
+        assert.Nil(t, err)
+    }
+
+    // Touch "a" so that "b" becomes the least recently used song.
+    slot, err := songs.Load(ctx, "a")
+    assert.Nil(t, err)
+    assert.Equal(t, slot, byte(0))
+
+    slot, err = songs.Load(ctx, "q")
+    assert.Nil(t, err)
+    assert.Equal(t, slot, byte(1), "Expected the least recently used slot to be reused")
+    _, ok := songs.Slot("b")
+    assert.False(t, ok, "Expected the evicted song to be forgotten")
+
+    // Redefining a song forces it to be re-programmed.
+    assert.Nil(t, songs.Define("a", []Note{{90, 8}}))
+    _, ok = songs.Slot("a")
+    assert.False(t, ok)
+
+    conn.Close()
+    written := dev.Written()
+    assert.Equal(t, written[len(written)-5:], []byte{140, 1, 1, 56, 8})
+}
+
+func TestSongManagerDefine(t *testing.T) {
+    songs := NewSongManager(nil)
+    assert.NotNil(t, songs.Define("empty", []Note{}), "Expected defining an empty song to fail")
+    assert.NotNil(t, songs.Define("long", make([]Note, 17)), "Expected defining a song with more than 16 notes to fail")
+    assert.Nil(t, songs.Define("ok", make([]Note, 16)))
+}
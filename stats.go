@@ -0,0 +1,106 @@
+package gocreate
+
+import (
+    "time"
+)
+
+// Latency summarises a set of measured durations.
+type Latency struct {
+    Count uint64
+    Last  time.Duration
+    Min   time.Duration
+    Max   time.Duration
+    Total time.Duration
+}
+
+// Mean returns the average duration, or 0 if nothing has been measured.
+func (l Latency) Mean() time.Duration {
+    if l.Count == 0 {
+        return 0
+    }
+    return l.Total / time.Duration(l.Count)
+}
+
+func (l *Latency) add(d time.Duration) {
+    if l.Count == 0 || d < l.Min {
+        l.Min = d
+    }
+    if d > l.Max {
+        l.Max = d
+    }
+    l.Count++
+    l.Last = d
+    l.Total += d
+}
+
+// Stats is a snapshot of the health of a connection's link to the Create.
+//
+// Throughput describes the data written, including pacing delays (see Throughput).
+//
+// OpcodeCommands and OpcodeBytes count the commands and bytes written for each opcode.
+//
+// BytesReceived is the number of bytes received from the Create.
+//
+// QueueDepth is the number of commands currently waiting to be written.
+//
+// SendLatency measures the time from a call to Send to the command being written.
+//
+// SensorLatency measures the time from a sensor request being written to its reply
+// being received.
+//
+// Timeouts counts sensor requests which received no reply at all.
+//
+// ParseErrors counts sensor replies which were incomplete or invalid.
+//
+// Resyncs counts the times that received data which did not belong to any reply was
+// discarded to get back in step with the Create.
+type Stats struct {
+    Throughput     Throughput
+    OpcodeCommands map[byte]uint64
+    OpcodeBytes    map[byte]uint64
+    BytesReceived  uint64
+    QueueDepth     int
+    SendLatency    Latency
+    SensorLatency  Latency
+    Timeouts       uint64
+    ParseErrors    uint64
+    Resyncs        uint64
+}
+
+// Stats returns a snapshot of the connection's statistics.
+func (c *Connection) Stats() Stats {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+
+    s := c.stats
+    s.Throughput = c.written
+    s.QueueDepth = len(c.sendQueue)
+    s.OpcodeCommands = make(map[byte]uint64, len(c.stats.OpcodeCommands))
+    for op, n := range c.stats.OpcodeCommands {
+        s.OpcodeCommands[op] = n
+    }
+    s.OpcodeBytes = make(map[byte]uint64, len(c.stats.OpcodeBytes))
+    for op, n := range c.stats.OpcodeBytes {
+        s.OpcodeBytes[op] = n
+    }
+    return s
+}
+
+// recordWrite counts a written command.  The caller must hold the state lock.
+func (c *Connection) recordWrite(data []byte) {
+    if len(data) == 0 {
+        return
+    }
+    if c.stats.OpcodeCommands == nil {
+        c.stats.OpcodeCommands = make(map[byte]uint64)
+        c.stats.OpcodeBytes = make(map[byte]uint64)
+    }
+    c.stats.OpcodeCommands[data[0]]++
+    c.stats.OpcodeBytes[data[0]] += uint64(len(data))
+}
+
+func (c *Connection) updateStats(update func(s *Stats)) {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    update(&c.stats)
+}
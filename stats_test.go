@@ -0,0 +1,89 @@
+package gocreate
+
+import (
+    "context"
+    "github.com/stretchr/testify/assert"
+    "testing"
+    "time"
+)
+
+func TestLatency(t *testing.T) {
+    var l Latency
+    assert.Equal(t, l.Mean(), time.Duration(0))
+
+    l.add(30 * time.Millisecond)
+    l.add(10 * time.Millisecond)
+    l.add(20 * time.Millisecond)
+    assert.Equal(t, l, Latency{Count: 3, Last: 20 * time.Millisecond, Min: 10 * time.Millisecond, Max: 30 * time.Millisecond,
+        Total: 60 * time.Millisecond})
+    assert.Equal(t, l.Mean(), 20*time.Millisecond)
+}
+
+func TestStats(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    conn := NewConnection(dev, 57600)
+    ctx := context.Background()
+
+    assert.Nil(t, conn.Send(ctx, Start()))
+    assert.Nil(t, conn.Send(ctx, DriveStraight(100)))
+    assert.Nil(t, conn.Send(ctx, DriveDirect(100, 100)))
+    _, err := conn.Query(ctx, PacketOIMode)
+    assert.Nil(t, err)
+
+    dev.lock.Lock()
+    dev.robotRate = 0
+    dev.lock.Unlock()
+    _, err = conn.Query(ctx, PacketOIMode)
+    assert.Equal(t, err, ErrNoResponse)
+
+    // Data which nobody asked for is discarded.
+    dev.lock.Lock()
+    dev.replies = append(dev.replies, 0x55, 0xAA)
+    dev.lock.Unlock()
+    dev.cond.Broadcast()
+    deadline := time.Now().Add(time.Second)
+    for conn.Stats().Resyncs == 0 && time.Now().Before(deadline) {
+        time.Sleep(time.Millisecond)
+    }
+
+    stats := conn.Stats()
+    assert.Equal(t, stats.Throughput.Bytes, uint64(15))
+    assert.Equal(t, stats.Throughput.Commands, uint64(5))
+    assert.Equal(t, stats.OpcodeCommands, map[byte]uint64{128: 1, 137: 1, 142: 2, 145: 1})
+    assert.Equal(t, stats.OpcodeBytes, map[byte]uint64{128: 1, 137: 5, 142: 4, 145: 5})
+    assert.Equal(t, stats.BytesReceived, uint64(3))
+    assert.Equal(t, stats.QueueDepth, 0)
+    assert.Equal(t, stats.SendLatency.Count, uint64(4))
+    assert.Equal(t, stats.SensorLatency.Count, uint64(1))
+    assert.Equal(t, stats.Timeouts, uint64(1))
+    assert.Equal(t, stats.ParseErrors, uint64(0))
+    assert.Equal(t, stats.Resyncs, uint64(1))
+
+    // Snapshots are independent of the connection.
+    stats.OpcodeCommands[128] = 100
+    assert.Equal(t, conn.Stats().OpcodeCommands[128], uint64(1))
+    assert.Nil(t, conn.Close())
+}
+
+func TestStatsParseError(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    conn := NewConnection(dev, 57600)
+
+    // Only half of a two byte reply arrives.
+    dev.lock.Lock()
+    dev.robotRate = 0
+    dev.lock.Unlock()
+    go func() {
+        for len(conn.Stats().OpcodeCommands) == 0 {
+            time.Sleep(time.Millisecond)
+        }
+        dev.lock.Lock()
+        dev.replies = append(dev.replies, 0x01)
+        dev.lock.Unlock()
+        dev.cond.Broadcast()
+    }()
+    _, err := conn.Query(context.Background(), PacketDistance)
+    assert.Equal(t, err, ErrNoResponse)
+    assert.Equal(t, conn.Stats().ParseErrors, uint64(1))
+    assert.Nil(t, conn.Close())
+}
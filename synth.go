@@ -0,0 +1,110 @@
+package gocreate
+
+import (
+    "encoding/binary"
+    "errors"
+    "io"
+    "math"
+)
+
+// DefaultSampleRate is a sample rate, in Hz, suitable for previewing songs.
+const DefaultSampleRate uint = 22050
+
+// songAmplitude is the peak value of the synthesized square wave, chosen to leave
+// plenty of headroom in a 16-bit sample.
+const songAmplitude int16 = 8192
+
+// ToneFrequency returns the frequency in Hz of the given MIDI tone value.  Values < 31
+// or > 127 are rest (silent) tones on the Create, so 0 is returned for them.
+func ToneFrequency(tone byte) float64 {
+    if tone < 31 || tone > 127 {
+        return 0
+    }
+
+    return 440.0 * math.Pow(2, (float64(tone)-69.0)/12.0)
+}
+
+// SongDuration returns the total playing time of a song in units of 1/64 of a second.
+func SongDuration(song []Note) uint {
+    var total uint
+    for _, n := range song {
+        total += uint(n.Duration)
+    }
+    return total
+}
+
+// SynthesizeSong renders a song as signed 16-bit mono PCM samples at the given sample
+// rate.  Each note is rendered as a square wave at the note's MIDI tone frequency for
+// its duration in 1/64 of a second, and rest tones are rendered as silence.
+func SynthesizeSong(song []Note, sampleRate uint) []int16 {
+    if sampleRate == 0 {
+        return nil
+    }
+
+    samples := make([]int16, 0, SongDuration(song)*sampleRate/64)
+    for _, n := range song {
+        count := int(uint(n.Duration) * sampleRate / 64)
+        freq := ToneFrequency(n.Tone)
+        for i := 0; i < count; i++ {
+            if freq == 0 {
+                samples = append(samples, 0)
+                continue
+            }
+
+            _, phase := math.Modf(float64(i) * freq / float64(sampleRate))
+            if phase < 0.5 {
+                samples = append(samples, songAmplitude)
+            } else {
+                samples = append(samples, -songAmplitude)
+            }
+        }
+    }
+    return samples
+}
+
+// WriteSongWav synthesizes a song (see SynthesizeSong) and writes it to w as a mono
+// 16-bit PCM WAV file.  An error is returned without writing anything if the sample
+// rate is 0.
+func WriteSongWav(w io.Writer, song []Note, sampleRate uint) error {
+    if sampleRate == 0 {
+        return errors.New("Invalid sample rate")
+    }
+
+    samples := SynthesizeSong(song, sampleRate)
+    dataSize := uint32(len(samples) * 2)
+
+    header := struct {
+        RiffID        [4]byte
+        RiffSize      uint32
+        WaveID        [4]byte
+        FmtID         [4]byte
+        FmtSize       uint32
+        AudioFormat   uint16
+        Channels      uint16
+        SampleRate    uint32
+        ByteRate      uint32
+        BlockAlign    uint16
+        BitsPerSample uint16
+        DataID        [4]byte
+        DataSize      uint32
+    }{
+        RiffID:        [4]byte{'R', 'I', 'F', 'F'},
+        RiffSize:      36 + dataSize,
+        WaveID:        [4]byte{'W', 'A', 'V', 'E'},
+        FmtID:         [4]byte{'f', 'm', 't', ' '},
+        FmtSize:       16,
+        AudioFormat:   1,
+        Channels:      1,
+        SampleRate:    uint32(sampleRate),
+        ByteRate:      uint32(sampleRate) * 2,
+        BlockAlign:    2,
+        BitsPerSample: 16,
+        DataID:        [4]byte{'d', 'a', 't', 'a'},
+        DataSize:      dataSize,
+    }
+
+    if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+        return err
+    }
+    return binary.Write(w, binary.LittleEndian, samples)
+}
@@ -0,0 +1,73 @@
+package gocreate
+
+import (
+    "bytes"
+    "encoding/binary"
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestToneFrequency(t *testing.T) {
+    assert.InDelta(t, ToneFrequency(69), 440.0, 0.001)
+    assert.InDelta(t, ToneFrequency(81), 880.0, 0.001)
+    assert.InDelta(t, ToneFrequency(31), 48.999, 0.001)
+    assert.InDelta(t, ToneFrequency(127), 12543.854, 0.001)
+    assert.Equal(t, ToneFrequency(30), 0.0, "Expected tones below 31 to be rests")
+    assert.Equal(t, ToneFrequency(128), 0.0, "Expected tones above 127 to be rests")
+}
+
+func TestSongDuration(t *testing.T) {
+    assert.Equal(t, SongDuration([]Note{{69, 32}, {0, 16}, {81, 200}}), uint(248))
+    assert.Equal(t, SongDuration(nil), uint(0))
+}
+
+func TestSynthesizeSong(t *testing.T) {
+    samples := SynthesizeSong([]Note{{69, 64}, {0, 32}}, 8000)
+    if !assert.Len(t, samples, 12000) {
+        return
+    }
+
+    // A 440 Hz tone at 8000 Hz changes sign roughly 880 times in one second.
+    transitions := 0
+    for i := 1; i < 8000; i++ {
+        if samples[i] != samples[i-1] {
+            transitions++
+        }
+    }
+    assert.InDelta(t, transitions, 880, 2)
+
+    for i, s := range samples[8000:] {
+        if s != 0 {
+            t.Errorf("Expected silence during rest note at sample %d, got %d", 8000+i, s)
+            break
+        }
+    }
+
+    assert.Nil(t, SynthesizeSong([]Note{{69, 64}}, 0), "Expected synthesis with zero sample rate to fail")
+}
+
+func TestWriteSongWav(t *testing.T) {
+    var buf bytes.Buffer
+    err := WriteSongWav(&buf, []Note{{72, 16}}, DefaultSampleRate)
+    if !assert.Nil(t, err) {
+        return
+    }
+
+    data := buf.Bytes()
+    samples := int(16 * DefaultSampleRate / 64)
+    if !assert.Len(t, data, 44+2*samples) {
+        return
+    }
+    assert.Equal(t, data[0:4], []byte("RIFF"))
+    assert.Equal(t, data[8:16], []byte("WAVEfmt "))
+    assert.Equal(t, data[36:40], []byte("data"))
+    assert.Equal(t, binary.LittleEndian.Uint32(data[4:8]), uint32(36+2*samples))
+    assert.Equal(t, binary.LittleEndian.Uint16(data[22:24]), uint16(1), "Expected a mono WAV file")
+    assert.Equal(t, binary.LittleEndian.Uint32(data[24:28]), uint32(DefaultSampleRate))
+    assert.Equal(t, binary.LittleEndian.Uint16(data[34:36]), uint16(16), "Expected 16-bit samples")
+    assert.Equal(t, binary.LittleEndian.Uint32(data[40:44]), uint32(2*samples))
+
+    buf.Reset()
+    assert.NotNil(t, WriteSongWav(&buf, []Note{{72, 16}}, 0), "Expected a sample rate of 0 to be rejected")
+    assert.Equal(t, buf.Len(), 0, "Expected nothing to be written")
+}
@@ -0,0 +1,304 @@
+package gocreate
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "net"
+    "sync"
+    "time"
+)
+
+// Telnet and RFC 2217 protocol constants.
+const (
+    telnetSE   byte = 240
+    telnetSB   byte = 250
+    telnetWILL byte = 251
+    telnetWONT byte = 252
+    telnetDO   byte = 253
+    telnetDONT byte = 254
+    telnetIAC  byte = 255
+
+    telnetOptionBinary  byte = 0
+    telnetOptionSGA     byte = 3
+    telnetOptionComPort byte = 44
+
+    comPortSetBaud         byte = 1
+    comPortSetBaudResponse byte = 101
+)
+
+// rfc2217Timeout is how long to wait for an RFC 2217 server to acknowledge a baud rate
+// change.
+const rfc2217Timeout = 2 * time.Second
+
+const (
+    telnetStateData = iota
+    telnetStateIAC
+    telnetStateOption
+    telnetStateSub
+    telnetStateSubIAC
+)
+
+// telnetParser splits a telnet byte stream into data, option negotiations, and
+// subnegotiations.
+type telnetParser struct {
+    state    int
+    command  byte
+    sub      []byte
+    onData   func(b byte)
+    onOption func(command byte, option byte)
+    onSub    func(sub []byte)
+}
+
+func (p *telnetParser) feed(b byte) {
+    switch p.state {
+    case telnetStateData:
+        if b == telnetIAC {
+            p.state = telnetStateIAC
+        } else {
+            p.onData(b)
+        }
+    case telnetStateIAC:
+        switch b {
+        case telnetIAC:
+            p.onData(b)
+            p.state = telnetStateData
+        case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+            p.command = b
+            p.state = telnetStateOption
+        case telnetSB:
+            p.sub = p.sub[:0]
+            p.state = telnetStateSub
+        default:
+            p.state = telnetStateData
+        }
+    case telnetStateOption:
+        p.onOption(p.command, b)
+        p.state = telnetStateData
+    case telnetStateSub:
+        if b == telnetIAC {
+            p.state = telnetStateSubIAC
+        } else {
+            p.sub = append(p.sub, b)
+        }
+    case telnetStateSubIAC:
+        switch b {
+        case telnetIAC:
+            p.sub = append(p.sub, b)
+            p.state = telnetStateSub
+        case telnetSE:
+            p.onSub(p.sub)
+            p.state = telnetStateData
+        default:
+            p.state = telnetStateData
+        }
+    }
+}
+
+// telnetEscape doubles any IAC bytes in data so that they are transmitted literally.
+func telnetEscape(data []byte) []byte {
+    escaped := make([]byte, 0, len(data))
+    for _, b := range data {
+        if b == telnetIAC {
+            escaped = append(escaped, telnetIAC)
+        }
+        escaped = append(escaped, b)
+    }
+    return escaped
+}
+
+// comPortSubnegotiation builds an RFC 2217 COM-PORT-OPTION subnegotiation.
+func comPortSubnegotiation(command byte, value []byte) []byte {
+    msg := []byte{telnetIAC, telnetSB, telnetOptionComPort, command}
+    msg = append(msg, telnetEscape(value)...)
+    return append(msg, telnetIAC, telnetSE)
+}
+
+// RFC2217Transport is a transport to a Create attached to a remote serial port which
+// is shared using an RFC 2217 (Telnet COM Port Control) server.  It implements
+// BaudSetter, so Baud commands sent over a Connection using this transport also change
+// the remote serial port's baud rate.
+//
+// For plain ser2net-style bridges which do not support RFC 2217, a net.Conn can be used
+// directly as a Connection's transport, though the bridge's baud rate will then not
+// follow Baud commands.
+type RFC2217Transport struct {
+    conn       net.Conn
+    writeLock  sync.Mutex
+    lock       sync.Mutex
+    cond       *sync.Cond
+    data       []byte
+    readErr    error
+    negotiated map[[2]byte]bool
+    acks       chan uint32
+}
+
+// DialRFC2217 connects to an RFC 2217 server at the given TCP address and sets the
+// remote serial port to the given baud rate.  A baud rate of 0 leaves the remote port at
+// the rate the server has configured.
+func DialRFC2217(address string, baud uint) (*RFC2217Transport, error) {
+    conn, err := net.Dial("tcp", address)
+    if err != nil {
+        return nil, err
+    }
+
+    t := &RFC2217Transport{conn: conn, negotiated: make(map[[2]byte]bool), acks: make(chan uint32, 1)}
+    t.cond = sync.NewCond(&t.lock)
+    go t.receiver()
+
+    err = t.sendOptions([][2]byte{
+        {telnetWILL, telnetOptionBinary},
+        {telnetDO, telnetOptionBinary},
+        {telnetWILL, telnetOptionComPort},
+    })
+    if err == nil && baud != 0 {
+        err = t.SetBaud(baud)
+    }
+    if err != nil {
+        conn.Close()
+        return nil, err
+    }
+    return t, nil
+}
+
+func (t *RFC2217Transport) sendOptions(options [][2]byte) error {
+    var msg []byte
+    t.lock.Lock()
+    for _, o := range options {
+        t.negotiated[o] = true
+        msg = append(msg, telnetIAC, o[0], o[1])
+    }
+    t.lock.Unlock()
+
+    return t.writeRaw(msg)
+}
+
+func (t *RFC2217Transport) writeRaw(data []byte) error {
+    t.writeLock.Lock()
+    defer t.writeLock.Unlock()
+
+    _, err := t.conn.Write(data)
+    return err
+}
+
+// handleOption answers option requests from the server.  Binary transmission, suppress
+// go-ahead and the COM port option are accepted and everything else is refused.
+func (t *RFC2217Transport) handleOption(command byte, option byte) {
+    var reply byte
+    accepted := option == telnetOptionBinary || option == telnetOptionSGA || option == telnetOptionComPort
+    switch command {
+    case telnetWILL:
+        reply = telnetDONT
+        if accepted {
+            reply = telnetDO
+        }
+    case telnetDO:
+        reply = telnetWONT
+        if accepted {
+            reply = telnetWILL
+        }
+    default:
+        return
+    }
+
+    t.lock.Lock()
+    key := [2]byte{reply, option}
+    answered := t.negotiated[key]
+    t.negotiated[key] = true
+    t.lock.Unlock()
+
+    if !answered {
+        t.writeRaw([]byte{telnetIAC, reply, option})
+    }
+}
+
+func (t *RFC2217Transport) handleSub(sub []byte) {
+    if len(sub) == 6 && sub[0] == telnetOptionComPort && sub[1] == comPortSetBaudResponse {
+        select {
+        case t.acks <- binary.BigEndian.Uint32(sub[2:]):
+        default:
+        }
+    }
+}
+
+func (t *RFC2217Transport) receiver() {
+    parser := &telnetParser{
+        onData: func(b byte) {
+            t.lock.Lock()
+            t.data = append(t.data, b)
+            t.lock.Unlock()
+            t.cond.Broadcast()
+        },
+        onOption: t.handleOption,
+        onSub:    t.handleSub,
+    }
+
+    r := bufio.NewReader(t.conn)
+    for {
+        b, err := r.ReadByte()
+        if err != nil {
+            t.lock.Lock()
+            t.readErr = err
+            t.lock.Unlock()
+            t.cond.Broadcast()
+            return
+        }
+        parser.feed(b)
+    }
+}
+
+// Read reads data received from the remote serial port.
+func (t *RFC2217Transport) Read(p []byte) (int, error) {
+    t.lock.Lock()
+    defer t.lock.Unlock()
+
+    for len(t.data) == 0 && t.readErr == nil {
+        t.cond.Wait()
+    }
+    if len(t.data) == 0 {
+        return 0, t.readErr
+    }
+
+    n := copy(p, t.data)
+    t.data = t.data[n:]
+    return n, nil
+}
+
+// Write transmits data to the remote serial port.
+func (t *RFC2217Transport) Write(p []byte) (int, error) {
+    if err := t.writeRaw(telnetEscape(p)); err != nil {
+        return 0, err
+    }
+    return len(p), nil
+}
+
+// Close closes the network connection.
+func (t *RFC2217Transport) Close() error {
+    return t.conn.Close()
+}
+
+// SetBaud asks the server to change the remote serial port's baud rate, and waits for
+// the change to be acknowledged.
+func (t *RFC2217Transport) SetBaud(rate uint) error {
+    select {
+    case <-t.acks:
+    default:
+    }
+
+    value := make([]byte, 4)
+    binary.BigEndian.PutUint32(value, uint32(rate))
+    if err := t.writeRaw(comPortSubnegotiation(comPortSetBaud, value)); err != nil {
+        return err
+    }
+
+    select {
+    case ack := <-t.acks:
+        if uint(ack) != rate {
+            return fmt.Errorf("RFC 2217 server set baud rate %d instead of %d", ack, rate)
+        }
+        return nil
+    case <-time.After(rfc2217Timeout):
+        return errors.New("Timed out waiting for RFC 2217 baud rate acknowledgement")
+    }
+}
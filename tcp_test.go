@@ -0,0 +1,158 @@
+package gocreate
+
+import (
+    "context"
+    "encoding/binary"
+    "github.com/stretchr/testify/assert"
+    "net"
+    "sync"
+    "testing"
+    "time"
+)
+
+// testBridge is a minimal in-process RFC 2217 server which records the data and baud
+// rates it receives, and answers some sensor requests as if a Create were attached.
+type testBridge struct {
+    listener net.Listener
+    lock     sync.Mutex
+    data     []byte
+    rates    []uint
+    options  [][2]byte
+    conn     net.Conn
+    done     chan struct{}
+}
+
+func newTestBridge(t *testing.T) *testBridge {
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("Failed to listen: %s", err.Error())
+    }
+
+    b := &testBridge{listener: l, done: make(chan struct{})}
+    go b.serve()
+    return b
+}
+
+func (b *testBridge) serve() {
+    defer close(b.done)
+    conn, err := b.listener.Accept()
+    if err != nil {
+        return
+    }
+    b.lock.Lock()
+    b.conn = conn
+    b.lock.Unlock()
+
+    parser := &telnetParser{
+        onData: func(c byte) {
+            b.lock.Lock()
+            b.data = append(b.data, c)
+            query := len(b.data) > 1 && b.data[len(b.data)-2] == 142
+            b.lock.Unlock()
+            if query && c == byte(PacketOIMode) {
+                conn.Write([]byte{byte(ModeFull)})
+            } else if query && c == byte(PacketRequestedVelocity) {
+                conn.Write([]byte{telnetIAC, telnetIAC, 0x38})
+            }
+        },
+        onOption: func(command byte, option byte) {
+            b.lock.Lock()
+            b.options = append(b.options, [2]byte{command, option})
+            b.lock.Unlock()
+            if command == telnetWILL && option == telnetOptionComPort {
+                conn.Write([]byte{telnetIAC, telnetDO, telnetOptionComPort})
+            }
+        },
+        onSub: func(sub []byte) {
+            if len(sub) == 6 && sub[0] == telnetOptionComPort && sub[1] == comPortSetBaud {
+                b.lock.Lock()
+                b.rates = append(b.rates, uint(binary.BigEndian.Uint32(sub[2:])))
+                b.lock.Unlock()
+                conn.Write(comPortSubnegotiation(comPortSetBaudResponse, sub[2:]))
+            }
+        },
+    }
+
+    buf := make([]byte, 64)
+    for {
+        n, err := conn.Read(buf)
+        for _, c := range buf[:n] {
+            parser.feed(c)
+        }
+        if err != nil {
+            return
+        }
+    }
+}
+
+func (b *testBridge) Close() {
+    b.listener.Close()
+    <-b.done
+}
+
+func TestRFC2217Transport(t *testing.T) {
+    bridge := newTestBridge(t)
+
+    transport, err := DialRFC2217(bridge.listener.Addr().String(), 57600)
+    if !assert.Nil(t, err) {
+        bridge.Close()
+        return
+    }
+
+    ctx := context.Background()
+    conn := NewConnection(transport, 57600)
+    assert.Nil(t, conn.Send(ctx, Baud(115200)))
+    assert.Nil(t, conn.Send(ctx, AbortDemo()))
+    assert.Nil(t, conn.Send(ctx, Spin(100, true)))
+
+    // Data from the serial port, including an escaped 0xFF byte, is passed through.
+    reply, err := conn.Query(ctx, PacketRequestedVelocity)
+    assert.Nil(t, err)
+    assert.Equal(t, reply, []byte{0xFF, 0x38})
+
+    assert.Nil(t, conn.Close())
+    bridge.Close()
+
+    assert.Equal(t, bridge.rates, []uint{57600, 115200}, "Expected the bridge to follow the baud rate")
+    assert.Equal(t, bridge.data, []byte{129, 11, 142, 35, 136, 255, 137, 0x00, 0x64, 0xFF, 0xFF, 142, 39}, "Transmitted data is incorrect")
+    assert.Contains(t, bridge.options, [2]byte{telnetWILL, telnetOptionComPort})
+    assert.Equal(t, conn.CurrentBaud(), uint(115200))
+}
+
+func TestRFC2217ServerBaud(t *testing.T) {
+    bridge := newTestBridge(t)
+
+    transport, err := DialRFC2217(bridge.listener.Addr().String(), 0)
+    if !assert.Nil(t, err) {
+        bridge.Close()
+        return
+    }
+
+    conn := NewConnection(transport, 57600)
+    assert.Nil(t, conn.Send(context.Background(), Start()))
+    assert.Nil(t, conn.Close())
+    bridge.Close()
+
+    assert.Empty(t, bridge.rates, "Expected the server's baud rate to be left alone")
+    assert.Equal(t, bridge.data, []byte{128})
+}
+
+func TestRFC2217Timeout(t *testing.T) {
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if !assert.Nil(t, err) {
+        return
+    }
+    defer l.Close()
+
+    // A server which never acknowledges the baud rate.
+    go func() {
+        conn, err := l.Accept()
+        if err == nil {
+            time.Sleep(rfc2217Timeout + time.Second)
+            conn.Close()
+        }
+    }()
+
+    _, err = DialRFC2217(l.Addr().String(), 57600)
+    assert.NotNil(t, err, "Expected dialing a server that does not acknowledge the baud rate to fail")
+}
@@ -0,0 +1,138 @@
+package gocreate
+
+import (
+    "fmt"
+    "log/slog"
+    "strings"
+    "time"
+)
+
+// Direction indicates whether traced data was sent to or received from the Create.
+type Direction int
+
+const (
+    // Outbound indicates data written to the Create.
+    Outbound Direction = iota
+    // Inbound indicates data received from the Create.
+    Inbound
+)
+
+func (d Direction) String() string {
+    if d == Inbound {
+        return "in"
+    }
+    return "out"
+}
+
+// TraceEvent describes a block of data written to or received from the Create.
+//
+// Time is when the data was written or received.
+//
+// Data is the raw data.  It must not be modified by the tracer.
+//
+// Command is the command which produced outbound data, and is nil for inbound data.
+type TraceEvent struct {
+    Time      time.Time
+    Direction Direction
+    Data      []byte
+    Command   Command
+}
+
+// Tracer is a function which is called for every block of data written to or received
+// from the Create.  It is called synchronously from the connection's goroutines, so it
+// should return quickly.
+type Tracer func(event TraceEvent)
+
+// opcodeNames maps OI opcodes to the names used in the OI specification.
+var opcodeNames = map[byte]string{
+    128: "Start",
+    129: "Baud",
+    130: "Control",
+    131: "Safe",
+    132: "Full",
+    134: "Spot",
+    135: "Cover",
+    136: "Demo",
+    137: "Drive",
+    138: "Low Side Drivers",
+    139: "LEDs",
+    140: "Song",
+    141: "Play Song",
+    142: "Sensors",
+    143: "Cover and Dock",
+    144: "PWM Low Side Drivers",
+    145: "Drive Direct",
+    147: "Digital Outputs",
+    148: "Stream",
+    149: "Query List",
+    150: "Pause/Resume Stream",
+    151: "Send IR",
+    152: "Script",
+    153: "Play Script",
+    154: "Show Script",
+    155: "Wait Time",
+    156: "Wait Distance",
+    157: "Wait Angle",
+    158: "Wait Event",
+}
+
+// OpcodeName returns the OI specification's name for an opcode, or a placeholder
+// containing the opcode's value if it is unknown.
+func OpcodeName(opcode byte) string {
+    if name, ok := opcodeNames[opcode]; ok {
+        return name
+    }
+    return fmt.Sprintf("Unknown (%d)", opcode)
+}
+
+// CommandName returns the OI specification's name for a command.  For a sequence of
+// commands written together by SendMany, the names are joined by commas.
+func CommandName(cmd Command) string {
+    if b, ok := cmd.(*batchCommand); ok {
+        names := make([]string, len(b.Commands))
+        for i, c := range b.Commands {
+            names[i] = CommandName(c)
+        }
+        return strings.Join(names, ", ")
+    }
+
+    data := cmd.Assemble()
+    if len(data) == 0 {
+        return "Empty"
+    }
+    return OpcodeName(data[0])
+}
+
+// SetTracer installs a tracer which is called for all data written to and received
+// from the Create.  Passing nil disables tracing.
+func (c *Connection) SetTracer(tracer Tracer) {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    c.tracer = tracer
+}
+
+func (c *Connection) trace(direction Direction, data []byte) {
+    c.stateLock.Lock()
+    tracer := c.tracer
+    c.stateLock.Unlock()
+
+    if tracer != nil {
+        tracer(TraceEvent{Time: time.Now(), Direction: direction, Data: append([]byte(nil), data...)})
+    }
+}
+
+// SlogTracer returns a tracer which logs each event to the given logger at debug level,
+// including a hex dump of the data and the name of the command that produced it.
+func SlogTracer(logger *slog.Logger) Tracer {
+    return func(event TraceEvent) {
+        attrs := []interface{}{
+            slog.Time("time", event.Time),
+            slog.String("direction", event.Direction.String()),
+            slog.String("data", fmt.Sprintf("% X", event.Data)),
+        }
+        if event.Command != nil {
+            attrs = append(attrs, slog.String("command", CommandName(event.Command)))
+        }
+        logger.Debug("OI traffic", attrs...)
+    }
+}
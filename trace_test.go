@@ -0,0 +1,71 @@
+package gocreate
+
+import (
+    "bytes"
+    "context"
+    "github.com/stretchr/testify/assert"
+    "log/slog"
+    "sync"
+    "testing"
+)
+
+func TestTracer(t *testing.T) {
+    dev := newRobotTestDevice(57600)
+    conn := NewConnection(dev, 57600)
+    ctx := context.Background()
+
+    var lock sync.Mutex
+    var events []TraceEvent
+    conn.SetTracer(func(event TraceEvent) {
+        lock.Lock()
+        events = append(events, event)
+        lock.Unlock()
+    })
+
+    start := Start()
+    assert.Nil(t, conn.Send(ctx, start))
+    _, err := conn.Query(ctx, PacketOIMode)
+    assert.Nil(t, err)
+
+    conn.SetTracer(nil)
+    assert.Nil(t, conn.Send(ctx, Safe()))
+    assert.Nil(t, conn.Close())
+
+    lock.Lock()
+    defer lock.Unlock()
+    if !assert.Len(t, events, 3) {
+        return
+    }
+    assert.Equal(t, events[0].Direction, Outbound)
+    assert.Equal(t, events[0].Data, []byte{128})
+    assert.True(t, events[0].Command == start, "Expected the event to refer to the command that was sent")
+    assert.Equal(t, events[1].Direction, Outbound)
+    assert.Equal(t, events[1].Data, []byte{142, 35})
+    assert.Equal(t, CommandName(events[1].Command), "Sensors")
+    assert.Equal(t, events[2].Direction, Inbound)
+    assert.Equal(t, events[2].Data, []byte{byte(ModePassive)})
+    assert.Nil(t, events[2].Command)
+    assert.False(t, events[1].Time.After(events[2].Time), "Expected events to be in time order")
+}
+
+func TestSlogTracer(t *testing.T) {
+    var buf bytes.Buffer
+    logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+    conn, _ := newTestConnection()
+    conn.SetTracer(SlogTracer(logger))
+    assert.Nil(t, conn.Send(context.Background(), DriveDirect(-1, 1)))
+    assert.Nil(t, conn.Close())
+
+    output := buf.String()
+    assert.Contains(t, output, "direction=out")
+    assert.Contains(t, output, `data="91 FF FF 00 01"`)
+    assert.Contains(t, output, `command="Drive Direct"`)
+}
+
+func TestOpcodeName(t *testing.T) {
+    assert.Equal(t, OpcodeName(128), "Start")
+    assert.Equal(t, OpcodeName(149), "Query List")
+    assert.Equal(t, OpcodeName(12), "Unknown (12)")
+    assert.Equal(t, CommandName(Leds(true, true, 0, 0)), "LEDs")
+}
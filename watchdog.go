@@ -0,0 +1,87 @@
+package gocreate
+
+import (
+    "context"
+    "errors"
+    "time"
+)
+
+// ErrInvalidInterval is returned when a periodic task is started with an interval which
+// is not positive.
+var ErrInvalidInterval = errors.New("Interval must be positive")
+
+// StartWatchdog enables a dead-man watchdog on the connection.  If no motion command
+// (Drive, DriveStraight, Spin or DriveDirect) has been written within the given interval,
+// a zero DriveDirect command is sent to halt the Create.  The halt is sent once per idle
+// period, so the watchdog only sends another after a new motion command has been
+// written.  This protects against the Create driving on indefinitely at its last
+// velocity if the controlling application hangs or loses its client.
+//
+// Starting the watchdog again replaces the previous interval.  The watchdog is stopped
+// when the connection is closed.  ErrInvalidInterval is returned if the interval is not
+// positive.
+func (c *Connection) StartWatchdog(interval time.Duration) error {
+    if interval <= 0 {
+        return ErrInvalidInterval
+    }
+
+    stop := make(chan struct{})
+    c.stateLock.Lock()
+    if c.watchdog != nil {
+        close(c.watchdog)
+    }
+    c.watchdog = stop
+    c.stateLock.Unlock()
+
+    go c.watch(interval, stop)
+    return nil
+}
+
+// StopWatchdog disables the dead-man watchdog, if it is running.
+func (c *Connection) StopWatchdog() {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+
+    if c.watchdog != nil {
+        close(c.watchdog)
+        c.watchdog = nil
+    }
+}
+
+func (c *Connection) lastMotion() time.Time {
+    c.stateLock.Lock()
+    defer c.stateLock.Unlock()
+    return c.lastMove
+}
+
+func (c *Connection) watch(interval time.Duration, stop chan struct{}) {
+    var halted time.Time
+    wait := interval
+    for {
+        select {
+        case <-stop:
+            return
+        case <-time.After(wait):
+        }
+
+        last := c.lastMotion()
+        if idle := time.Since(last); idle < interval {
+            wait = interval - idle
+            continue
+        }
+        wait = interval
+        if !halted.IsZero() && last.Equal(halted) {
+            continue
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), interval)
+        err := c.Send(ctx, DriveDirect(0, 0))
+        cancel()
+        if err == ErrClosed {
+            return
+        }
+        if err == nil || err == ErrEmergencyStop {
+            halted = c.lastMotion()
+        }
+    }
+}
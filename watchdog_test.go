@@ -0,0 +1,51 @@
+package gocreate
+
+import (
+    "bytes"
+    "context"
+    "github.com/stretchr/testify/assert"
+    "testing"
+    "time"
+)
+
+func TestWatchdog(t *testing.T) {
+    conn, dev := newTestConnection()
+    ctx := context.Background()
+    assert.Nil(t, conn.StartWatchdog(30*time.Millisecond))
+
+    assert.Nil(t, conn.Send(ctx, DriveStraight(100)))
+    time.Sleep(100 * time.Millisecond)
+    assert.Nil(t, conn.Send(ctx, Spin(100, false)))
+    time.Sleep(100 * time.Millisecond)
+    assert.Nil(t, conn.Close())
+
+    drive := DriveStraight(100).Assemble()
+    spin := Spin(100, false).Assemble()
+    halt := DriveDirect(0, 0).Assemble()
+    expected := bytes.Join([][]byte{drive, halt, spin, halt}, nil)
+    assert.Equal(t, dev.Written(), expected, "Expected one halt after each idle period")
+}
+
+func TestWatchdogInterval(t *testing.T) {
+    conn, _ := newTestConnection()
+    assert.Equal(t, conn.StartWatchdog(0), ErrInvalidInterval)
+    assert.Equal(t, conn.StartWatchdog(-time.Second), ErrInvalidInterval)
+    assert.Nil(t, conn.Close())
+}
+
+func TestWatchdogActive(t *testing.T) {
+    conn, dev := newTestConnection()
+    ctx := context.Background()
+    assert.Nil(t, conn.StartWatchdog(50*time.Millisecond))
+
+    for i := 0; i < 10; i++ {
+        assert.Nil(t, conn.Send(ctx, DriveStraight(100)))
+        time.Sleep(10 * time.Millisecond)
+    }
+    conn.StopWatchdog()
+    time.Sleep(100 * time.Millisecond)
+    assert.Nil(t, conn.Close())
+
+    expected := bytes.Repeat(DriveStraight(100).Assemble(), 10)
+    assert.Equal(t, dev.Written(), expected, "Expected no halt while motion commands keep arriving")
+}